@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/tischda/peekenv/v3/envreg"
+)
+
+// maxValueLength is the maximum length of an environment variable value on Windows.
+const maxValueLength = 32767
+
+// unresolvedRef matches a %VAR% reference left in a value after expansion.
+var unresolvedRef = regexp.MustCompile(`%[^%;]+%`)
+
+// fileSystem is the part of the file system used by the checks.
+type fileSystem interface {
+	Stat(name string) (fs.FileInfo, error)
+}
+
+// osFS is the file system of the operating system.
+type osFS struct{}
+
+// Stat returns the file info of the named file.
+func (osFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// finding is a problem found in a variable, or in one of its entries.
+type finding struct {
+	variable string
+	index    int // index of the entry, -1 for the whole variable
+	entry    string
+	hive     string
+	problem  string
+}
+
+// String formats the finding, eg. "Path[3] (HKCU): C:\old: directory does not exist".
+func (f finding) String() string {
+	if f.index < 0 {
+		return fmt.Sprintf("%s: %s", f.variable, f.problem)
+	}
+	return fmt.Sprintf("%s[%d] (%s): %s: %s", f.variable, f.index, f.hive, f.entry, f.problem)
+}
+
+// runCheck checks the entries of Path-like variables and writes the problems found to w.
+// If no variables were requested, the variables matching the merge policy are checked.
+//
+// Parameters:
+//   - cfg: the runtime configuration specifying the registry mode
+//   - p: the peekenv instance reading the environment
+//   - w: the writer receiving the findings
+//   - fsys: the file system used to check that directories exist
+//
+// Returns true if problems were found, or an error if the environment cannot be read.
+func runCheck(cfg *Config, p *peekenv, w io.Writer, fsys fileSystem) (bool, error) {
+	all := len(p.opts.Variables) == 0
+	if err := p.read(cfg.mode(), false); err != nil {
+		return false, err
+	}
+
+	var findings []finding
+	e := p.env.Expander()
+	for _, name := range p.env.Names() {
+		if all && !p.env.Merge.Merges(name) {
+			continue
+		}
+		findings = append(findings, checkList(name, p.env.Variables[name], e, fsys)...)
+	}
+	for _, f := range findings {
+		fmt.Fprintln(w, f)
+	}
+	return len(findings) > 0, nil
+}
+
+// checkList returns the problems found in the entries of a variable: empty
+// entries (except a trailing one, left by a final semicolon), unterminated quotes, duplicates (ignoring case, quotes and trailing
+// slashes), unresolved %VAR% references, directories that do not exist and
+// values exceeding maxValueLength UTF-16 code units, like the Windows limit.
+//
+// Parameters:
+//   - name: the name of the variable
+//   - v: the variable
+//   - e: the expander used to expand entries before checking
+//   - fsys: the file system used to check that directories exist
+func checkList(name string, v envreg.Variable, e *envreg.Expander, fsys fileSystem) []finding {
+	var findings []finding
+	seen := make(map[string]int)
+	hives := v.EntryHives()
+	expandedLength := 0
+
+	list := v.Entries()
+	for i, entry := range list {
+		f := finding{variable: name, index: i, entry: entry, hive: v.Hive.String()}
+		if i < len(hives) {
+			f.hive = hives[i].String()
+		}
+		expanded := e.Expand(entry)
+		if i > 0 {
+			expandedLength++
+		}
+		expandedLength += utf16Length(expanded)
+
+		if strings.TrimSpace(envreg.UnquoteEntry(entry)) == "" {
+			if i == len(list)-1 && i > 0 && entry == "" {
+				// a final semicolon is common and harmless
+				continue
+			}
+			f.problem = "empty entry"
+			findings = append(findings, f)
+			continue
+		}
+		if strings.Count(entry, `"`)%2 != 0 {
+			f.problem = "unterminated quote"
+			findings = append(findings, f)
+			continue
+		}
+
+		// Windows removes the quotes protecting semicolons when searching the path
+		dir := envreg.UnquoteEntry(expanded)
+		key := strings.ToLower(strings.TrimRight(dir, `\/`))
+		if first, ok := seen[key]; ok {
+			f.problem = fmt.Sprintf("duplicate of entry %d", first)
+			findings = append(findings, f)
+			continue
+		}
+		seen[key] = i
+
+		if ref := unresolvedRef.FindString(expanded); ref != "" {
+			f.problem = "unresolved reference " + ref
+			findings = append(findings, f)
+			continue
+		}
+
+		info, err := fsys.Stat(dir)
+		switch {
+		case err != nil:
+			f.problem = "directory does not exist"
+			findings = append(findings, f)
+		case !info.IsDir():
+			f.problem = "not a directory"
+			findings = append(findings, f)
+		}
+	}
+
+	if expandedLength > maxValueLength {
+		findings = append(findings, finding{
+			variable: name,
+			index:    -1,
+			problem:  fmt.Sprintf("expanded length %d exceeds %d characters", expandedLength, maxValueLength),
+		})
+	}
+	return findings
+}
+
+// utf16Length returns the length of s in UTF-16 code units, as counted by Windows.
+func utf16Length(s string) int {
+	n := 0
+	for _, r := range s {
+		if l := utf16.RuneLen(r); l > 0 {
+			n += l
+		} else {
+			n++ // invalid UTF-8 is replaced by U+FFFD
+		}
+	}
+	return n
+}
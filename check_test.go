@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/tischda/peekenv/v3/envreg"
+)
+
+// fakeFS is a file system where the keys are paths and the values tell if the path is a directory.
+type fakeFS map[string]bool
+
+// Stat returns the file info of a path in the fake file system.
+func (f fakeFS) Stat(name string) (fs.FileInfo, error) {
+	isDir, ok := f[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	mode := fs.FileMode(0o644)
+	if isDir {
+		mode = fs.ModeDir | 0o755
+	}
+	return fstest.MapFS{"f": {Mode: mode, ModTime: time.Now()}}.Stat("f")
+}
+
+func TestCheckList(t *testing.T) {
+	fsys := fakeFS{
+		`C:\Windows`:          true,
+		`C:\Windows\System32`: true,
+		`C:\Tools\tool.exe`:   false,
+	}
+	v := envreg.Variable{
+		Value: `C:\Windows;c:\windows\;;C:\Missing;%UNDEFINED_VAR%\bin;C:\Tools\tool.exe;C:\Windows\System32;`,
+		Hive:  envreg.HKLM,
+	}
+
+	var got []string
+	for _, f := range checkList("Path", v, envreg.NewExpander(nil, nil), fsys) {
+		got = append(got, f.String())
+	}
+	expected := []string{
+		`Path[1] (HKLM): c:\windows\: duplicate of entry 0`,
+		`Path[2] (HKLM): : empty entry`,
+		`Path[3] (HKLM): C:\Missing: directory does not exist`,
+		`Path[4] (HKLM): %UNDEFINED_VAR%\bin: unresolved reference %UNDEFINED_VAR%`,
+		`Path[5] (HKLM): C:\Tools\tool.exe: not a directory`,
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("checkList() =\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestCheckList_Expanded(t *testing.T) {
+	fsys := fakeFS{`C:\Program Files\Git\cmd`: true}
+	e := envreg.NewExpander(map[string]string{"ProgramFiles": `C:\Program Files`}, nil)
+	v := envreg.Variable{Value: `%ProgramFiles%\Git\cmd;C:\Program Files\Git\cmd\`, Hive: envreg.HKLM}
+
+	findings := checkList("Path", v, e, fsys)
+	if len(findings) != 1 || findings[0].problem != "duplicate of entry 0" {
+		t.Errorf("checkList() = %v, want duplicate of expanded entry", findings)
+	}
+}
+
+func TestCheckList_Quoted(t *testing.T) {
+	fsys := fakeFS{`C:\My;Tools`: true}
+	v := envreg.Variable{Value: `"C:\My;Tools";C:\My;Tools;"C:\Open;C:\x`, Hive: envreg.HKCU}
+
+	var got []string
+	for _, f := range checkList("Path", v, envreg.NewExpander(nil, nil), fsys) {
+		got = append(got, f.String())
+	}
+	expected := []string{
+		`Path[1] (HKCU): C:\My: directory does not exist`,
+		`Path[2] (HKCU): Tools: directory does not exist`,
+		`Path[3] (HKCU): "C:\Open;C:\x: unterminated quote`,
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("checkList() =\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestCheckList_Length(t *testing.T) {
+	long := `C:\` + strings.Repeat("x", maxValueLength)
+	fsys := fakeFS{long: true}
+	v := envreg.Variable{Value: long, Hive: envreg.HKCU}
+
+	findings := checkList("Path", v, envreg.NewExpander(nil, nil), fsys)
+	if len(findings) != 1 || findings[0].index != -1 {
+		t.Fatalf("checkList() = %v, want single length finding", findings)
+	}
+	expected := "Path: expanded length 32770 exceeds 32767 characters"
+	if findings[0].String() != expected {
+		t.Errorf("checkList() = %v, want %q", findings[0], expected)
+	}
+}
+
+func TestCheckList_LengthUTF16(t *testing.T) {
+	// 2 bytes in UTF-8 but 1 code unit in UTF-16
+	accented := `C:\` + strings.Repeat("é", maxValueLength-3)
+	// 4 bytes in UTF-8 and 2 code units in UTF-16
+	emoji := `C:\` + strings.Repeat("😀", maxValueLength/2)
+	fsys := fakeFS{accented: true, emoji: true}
+
+	if findings := checkList("Path", envreg.Variable{Value: accented}, envreg.NewExpander(nil, nil), fsys); len(findings) != 0 {
+		t.Errorf("checkList() = %v, want no findings", findings)
+	}
+	findings := checkList("Path", envreg.Variable{Value: emoji}, envreg.NewExpander(nil, nil), fsys)
+	expected := "Path: expanded length 32769 exceeds 32767 characters"
+	if len(findings) != 1 || findings[0].String() != expected {
+		t.Errorf("checkList() = %v, want %q", findings, expected)
+	}
+}
+
+func TestRunCheck(t *testing.T) {
+	system := envreg.NewMemSource(envreg.HKLM)
+	system.Set("Path", `C:\Windows;C:\Missing`, envreg.REG_SZ)
+	system.Set("PATHEXT", ".COM;.EXE", envreg.REG_SZ)
+	user := envreg.NewMemSource(envreg.HKCU)
+	user.Set("Path", `C:\Windows`, envreg.REG_SZ)
+	fsys := fakeFS{`C:\Windows`: true}
+
+	p := &peekenv{
+		opts: envreg.Options{System: system, User: user},
+	}
+	var buf bytes.Buffer
+	found, err := runCheck(&Config{}, p, &buf, fsys)
+	if err != nil {
+		t.Fatalf("runCheck() error = %v", err)
+	}
+	expected := "Path[1] (HKLM): C:\\Missing: directory does not exist\nPath[2] (HKCU): C:\\Windows: duplicate of entry 0\n"
+	if !found || buf.String() != expected {
+		t.Errorf("runCheck() = %v,\n%s\nwant:\n%s", found, buf.String(), expected)
+	}
+}
+
+func TestRunCheck_UnselectedReference(t *testing.T) {
+	system := envreg.NewMemSource(envreg.HKLM)
+	system.Set("JAVA_HOME", `C:\jdk`, envreg.REG_SZ)
+	system.Set("Path", `%JAVA_HOME%\bin`, envreg.REG_EXPAND_SZ)
+	fsys := fakeFS{`C:\jdk\bin`: true}
+
+	p := &peekenv{
+		opts: envreg.Options{System: system, User: envreg.NewMemSource(envreg.HKCU), Variables: []string{"Path"}},
+	}
+	var buf bytes.Buffer
+	found, err := runCheck(&Config{}, p, &buf, fsys)
+	if err != nil {
+		t.Fatalf("runCheck() error = %v", err)
+	}
+	if found {
+		t.Errorf("runCheck() = %q, want no problems", buf.String())
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/tischda/peekenv/v3/envreg"
+	"github.com/tischda/peekenv/v3/section"
+)
+
+// Change kinds, printed in front of each difference.
+const (
+	added   = '+'
+	removed = '-'
+	changed = '~'
+)
+
+// entryChange is a difference between two lists of Path entries.
+type entryChange struct {
+	kind     rune
+	entry    string
+	oldIndex int // position in the old list, -1 if added
+	newIndex int // position in the new list, -1 if removed
+}
+
+// varChange is a difference between two environment snapshots.
+type varChange struct {
+	kind     rune
+	name     string
+	oldValue string
+	newValue string
+	entries  []entryChange // entry-level differences for Path-like variables
+}
+
+// runDiff compares two snapshot files in the section format, or one snapshot
+// file with the live environment, and writes the differences to w.
+//
+// Parameters:
+//   - cfg: the runtime configuration, used to read the live environment
+//   - p: the peekenv instance reading the live environment
+//   - args: one or two snapshot file names
+//   - w: the writer receiving the differences
+//
+// Returns true if differences were found, or an error if a snapshot cannot be read.
+func runDiff(cfg *Config, p *peekenv, args []string, w io.Writer) (bool, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return false, fmt.Errorf("usage: %s diff FILE1 [FILE2]", name)
+	}
+	exclude := p.opts.Exclude
+	before, err := loadSnapshot(args[0], p.opts.Merge)
+	if err != nil {
+		return false, err
+	}
+
+	var after map[string]string
+	if len(args) == 2 {
+		after, err = loadSnapshot(args[1], p.opts.Merge)
+		if err != nil {
+			return false, err
+		}
+	} else {
+		// excluded variables are filtered below, with those of the file
+		p.opts.Variables, p.opts.Exclude = nil, nil
+		if err := p.read(cfg.mode(), cfg.expand); err != nil {
+			return false, err
+		}
+		after = make(map[string]string, len(p.env.Variables))
+		for k, v := range p.env.Variables {
+			after[k] = v.Value
+		}
+	}
+
+	// excluded variables are ignored in files as in the registry
+	filter, err := envreg.NewFilter(nil, exclude)
+	if err != nil {
+		return false, err
+	}
+	for _, env := range []map[string]string{before, after} {
+		for name := range env {
+			if !filter.Selects(name) {
+				delete(env, name)
+			}
+		}
+	}
+	p.unmatched = filter.Unmatched()
+
+	changes := diffEnv(before, after, p.opts.Merge)
+	writeDiff(w, changes)
+	return len(changes) > 0, nil
+}
+
+// loadSnapshot reads variables from a .env file, or from a file in the section format.
+// In the section format, the entries of the variables merged by policy are joined
+// with its separator, like the values read from the registry.
+func loadSnapshot(path string, policy envreg.MergePolicy) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close() //nolint:errcheck
+
+	if envreg.IsDotenvFile(path) {
+		env, err := envreg.ParseDotenv(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return env, nil
+	}
+
+	vars, err := section.Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	env := make(map[string]string, len(vars))
+	for _, v := range vars {
+		env[v.Name] = v.Value
+		if policy.Merges(v.Name) {
+			env[v.Name] = strings.Join(v.Entries, policy.Separator())
+		}
+	}
+	return env, nil
+}
+
+// diffEnv returns the differences between two sets of variables, sorted by name.
+// Variable names are compared case-insensitively, values are compared exactly.
+// Path-like variables are compared entry by entry.
+//
+// Parameters:
+//   - before, after: the variables to compare
+//   - policy: the merge policy, whose variables are lists even with a single entry,
+//     separated by the separator of the policy
+func diffEnv(before, after map[string]string, policy envreg.MergePolicy) []varChange {
+	oldNames := make(map[string]string, len(before))
+	for k := range before {
+		oldNames[strings.ToLower(k)] = k
+	}
+	newNames := make(map[string]string, len(after))
+	for k := range after {
+		newNames[strings.ToLower(k)] = k
+	}
+
+	var changes []varChange
+	for key, oldName := range oldNames {
+		newName, ok := newNames[key]
+		if !ok {
+			changes = append(changes, varChange{kind: removed, name: oldName, oldValue: before[oldName]})
+			continue
+		}
+		oldValue, newValue := before[oldName], after[newName]
+		if oldValue == newValue {
+			continue
+		}
+		change := varChange{kind: changed, name: newName, oldValue: oldValue, newValue: newValue}
+		if policy.Merges(newName) || strings.Contains(oldValue, ";") || strings.Contains(newValue, ";") {
+			change.entries = diffEntries(policy.Split(newName, oldValue), policy.Split(newName, newValue))
+		}
+		changes = append(changes, change)
+	}
+	for key, newName := range newNames {
+		if _, ok := oldNames[key]; !ok {
+			changes = append(changes, varChange{kind: added, name: newName, newValue: after[newName]})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return strings.ToLower(changes[i].name) < strings.ToLower(changes[j].name)
+	})
+	return changes
+}
+
+// diffEntries returns the entries inserted, removed and moved between two lists.
+// Entries that keep their relative order (the longest common subsequence) are
+// unchanged, entries present in both lists but out of order are reported as moved.
+func diffEntries(before, after []string) []entryChange {
+	// lcs[i][j] is the length of the longest common subsequence of before[i:] and after[j:]
+	lcs := make([][]int, len(before)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i] == after[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	// collect the entries that are not part of the common subsequence
+	var oldOnly, newOnly []int
+	i, j := 0, 0
+	for i < len(before) && j < len(after) {
+		switch {
+		case before[i] == after[j]:
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			oldOnly = append(oldOnly, i)
+			i++
+		default:
+			newOnly = append(newOnly, j)
+			j++
+		}
+	}
+	for ; i < len(before); i++ {
+		oldOnly = append(oldOnly, i)
+	}
+	for ; j < len(after); j++ {
+		newOnly = append(newOnly, j)
+	}
+
+	// pair entries removed from one position and inserted at another
+	var changes []entryChange
+	inserted := make(map[int]bool, len(newOnly))
+	for _, n := range newOnly {
+		inserted[n] = true
+	}
+	for _, o := range oldOnly {
+		moved := false
+		for _, n := range newOnly {
+			if inserted[n] && before[o] == after[n] {
+				changes = append(changes, entryChange{kind: changed, entry: before[o], oldIndex: o, newIndex: n})
+				inserted[n] = false
+				moved = true
+				break
+			}
+		}
+		if !moved {
+			changes = append(changes, entryChange{kind: removed, entry: before[o], oldIndex: o, newIndex: -1})
+		}
+	}
+	for _, n := range newOnly {
+		if inserted[n] {
+			changes = append(changes, entryChange{kind: added, entry: after[n], oldIndex: -1, newIndex: n})
+		}
+	}
+	return changes
+}
+
+// writeDiff prints the differences, one variable per line prefixed with the kind
+// of change (eg. "+ JAVA_HOME=C:\jdk"). Changed Path-like variables are followed
+// by their indented entry changes, with the index of the entry in the old and/or
+// new list (eg. "    ~ [5->1] C:\Tools").
+func writeDiff(w io.Writer, changes []varChange) {
+	for _, c := range changes {
+		switch {
+		case c.kind == added:
+			fmt.Fprintf(w, "+ %s=%s\n", c.name, c.newValue)
+		case c.kind == removed:
+			fmt.Fprintf(w, "- %s=%s\n", c.name, c.oldValue)
+		case c.entries == nil:
+			fmt.Fprintf(w, "~ %s=%s -> %s\n", c.name, c.oldValue, c.newValue)
+		default:
+			fmt.Fprintf(w, "~ %s\n", c.name)
+			for _, e := range c.entries {
+				switch e.kind {
+				case added:
+					fmt.Fprintf(w, "    + [%d] %s\n", e.newIndex, e.entry)
+				case removed:
+					fmt.Fprintf(w, "    - [%d] %s\n", e.oldIndex, e.entry)
+				default:
+					fmt.Fprintf(w, "    ~ [%d->%d] %s\n", e.oldIndex, e.newIndex, e.entry)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tischda/peekenv/v3/envreg"
+)
+
+func TestDiffEntries(t *testing.T) {
+	tests := []struct {
+		name     string
+		before   []string
+		after    []string
+		expected []entryChange
+	}{
+		{
+			name:     "identical",
+			before:   []string{"a", "b"},
+			after:    []string{"a", "b"},
+			expected: nil,
+		},
+		{
+			name:   "inserted",
+			before: []string{"a", "c"},
+			after:  []string{"a", "b", "c"},
+			expected: []entryChange{
+				{kind: added, entry: "b", oldIndex: -1, newIndex: 1},
+			},
+		},
+		{
+			name:   "removed",
+			before: []string{"a", "b", "c"},
+			after:  []string{"a", "c"},
+			expected: []entryChange{
+				{kind: removed, entry: "b", oldIndex: 1, newIndex: -1},
+			},
+		},
+		{
+			name:   "moved to front",
+			before: []string{"a", "b", "c"},
+			after:  []string{"c", "a", "b"},
+			expected: []entryChange{
+				{kind: changed, entry: "c", oldIndex: 2, newIndex: 0},
+			},
+		},
+		{
+			name:   "mixed",
+			before: []string{`C:\Windows`, `C:\OldJDK\bin`, `C:\Tools`},
+			after:  []string{`C:\Tools`, `C:\Windows`, `C:\Git\cmd`},
+			expected: []entryChange{
+				{kind: changed, entry: `C:\Windows`, oldIndex: 0, newIndex: 1},
+				{kind: removed, entry: `C:\OldJDK\bin`, oldIndex: 1, newIndex: -1},
+				{kind: added, entry: `C:\Git\cmd`, oldIndex: -1, newIndex: 2},
+			},
+		},
+		{
+			name:   "duplicate entry added",
+			before: []string{"a"},
+			after:  []string{"a", "a"},
+			expected: []entryChange{
+				{kind: added, entry: "a", oldIndex: -1, newIndex: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffEntries(tt.before, tt.after)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("diffEntries() = %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWriteDiff(t *testing.T) {
+	before := map[string]string{
+		"OLD_HOME": `C:\old`,
+		"TEMP":     `C:\Temp`,
+		"Path":     `C:\Windows;C:\OldJDK\bin;C:\Tools`,
+		"OS":       "Windows_NT",
+	}
+	after := map[string]string{
+		"JAVA_HOME": `C:\jdk`,
+		"temp":      `D:\Temp`,
+		"Path":      `C:\Tools;C:\Windows;C:\Git\cmd`,
+		"OS":        "Windows_NT",
+	}
+
+	var buf bytes.Buffer
+	writeDiff(&buf, diffEnv(before, after, envreg.MergePolicy{}))
+
+	expected := `+ JAVA_HOME=C:\jdk
+- OLD_HOME=C:\old
+~ Path
+    ~ [0->1] C:\Windows
+    - [1] C:\OldJDK\bin
+    + [2] C:\Git\cmd
+~ temp=C:\Temp -> D:\Temp
+`
+	if buf.String() != expected {
+		t.Errorf("writeDiff() =\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
+
+func TestDiffEnv_QuotedEntries(t *testing.T) {
+	before := map[string]string{"Path": `C:\a;C:\b`}
+	after := map[string]string{"Path": `C:\a;"C:\My;Tools";C:\b`}
+
+	var buf bytes.Buffer
+	writeDiff(&buf, diffEnv(before, after, envreg.MergePolicy{}))
+	expected := "~ Path\n    + [1] \"C:\\My;Tools\"\n"
+	if buf.String() != expected {
+		t.Errorf("writeDiff() =\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	dir := t.TempDir()
+	file1 := filepath.Join(dir, "before.txt")
+	file2 := filepath.Join(dir, "after.txt")
+	if err := os.WriteFile(file1, []byte("# header\n\n[Path]\nC:\\a\nC:\\b\n\n[TEMP]\nC:\\Temp\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file2, []byte("[Path]\nC:\\a\nC:\\b\n\n[TEMP]\nC:\\Temp\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	different, err := runDiff(&Config{}, &peekenv{}, []string{file1, file2}, &buf)
+	if err != nil {
+		t.Fatalf("runDiff() error = %v", err)
+	}
+	if different || buf.Len() != 0 {
+		t.Errorf("runDiff() = %v, %q, want no differences", different, buf.String())
+	}
+}
+
+func TestRunDiff_Live(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "before.txt")
+	if err := os.WriteFile(file, []byte("[OS]\nWindows_NT\n\n[Path]\n%SystemRoot%\\system32\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	system, user := fixtureSources()
+	p := &peekenv{
+		opts: envreg.Options{System: system, User: user},
+	}
+
+	var buf bytes.Buffer
+	different, err := runDiff(&Config{machine: true}, p, []string{file}, &buf)
+	if err != nil {
+		t.Fatalf("runDiff() error = %v", err)
+	}
+	expected := `~ Path
+    + [1] %SystemRoot%
++ PsModulePath=%ProgramFiles%\WindowsPowerShell\Modules
++ TEMP=%SystemRoot%\TEMP
+`
+	if !different || buf.String() != expected {
+		t.Errorf("runDiff() = %v,\n%s\nwant:\n%s", different, buf.String(), expected)
+	}
+}
+
+func TestRunDiff_Separator(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "before.txt")
+	if err := os.WriteFile(file, []byte("[Path]\nC:\\a\nC:\\b\n\n[TEMP]\nC:\\Temp\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	system, user := envreg.NewMemSource(envreg.HKLM), envreg.NewMemSource(envreg.HKCU)
+	system.Set("Path", `C:\a`, envreg.REG_SZ)
+	user.Set("Path", `C:\b`, envreg.REG_SZ)
+	user.Set("TEMP", `C:\Temp`, envreg.REG_SZ)
+	policy, err := envreg.NewMergePolicy("Path", "system", "|")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &peekenv{
+		opts: envreg.Options{System: system, User: user, Merge: policy},
+	}
+
+	var buf bytes.Buffer
+	different, err := runDiff(&Config{}, p, []string{file}, &buf)
+	if err != nil {
+		t.Fatalf("runDiff() error = %v", err)
+	}
+	if different || buf.Len() != 0 {
+		t.Errorf("runDiff() = %v, %q, want no differences", different, buf.String())
+	}
+}
+
+func TestRunDiff_Dotenv(t *testing.T) {
+	dir := t.TempDir()
+	file1 := filepath.Join(dir, "before.txt")
+	file2 := filepath.Join(dir, "after.env")
+	if err := os.WriteFile(file1, []byte("[Path]\nC:\\a\nC:\\b\n\n[TEMP]\nC:\\Temp\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file2, []byte("Path='C:\\a;C:\\b'\nTEMP='D:\\Temp'\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	different, err := runDiff(&Config{}, &peekenv{}, []string{file1, file2}, &buf)
+	if err != nil {
+		t.Fatalf("runDiff() error = %v", err)
+	}
+	expected := "~ TEMP=C:\\Temp -> D:\\Temp\n"
+	if !different || buf.String() != expected {
+		t.Errorf("runDiff() = %v,\n%s\nwant:\n%s", different, buf.String(), expected)
+	}
+}
+
+func TestRunDiff_Exclude(t *testing.T) {
+	dir := t.TempDir()
+	file1 := filepath.Join(dir, "before.txt")
+	file2 := filepath.Join(dir, "after.txt")
+	if err := os.WriteFile(file1, []byte("[OS]\nWindows_NT\n\n[TEMP]\nC:\\Temp\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file2, []byte("[OS]\nWindows_NT\n\n[TEMP]\nD:\\Temp\n\n[TMP]\nD:\\Temp\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	different, err := runDiff(&Config{}, &peekenv{opts: envreg.Options{Exclude: []string{"T*"}}}, []string{file1, file2}, &buf)
+	if err != nil {
+		t.Fatalf("runDiff() error = %v", err)
+	}
+	if different || buf.Len() != 0 {
+		t.Errorf("runDiff() = %v, %q, want no differences", different, buf.String())
+	}
+}
@@ -0,0 +1,151 @@
+package envreg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// dotenvPlain matches the values written without quotes in .env files.
+var dotenvPlain = regexp.MustCompile(`^[A-Za-z0-9_./:,%+@=-]*$`)
+
+// dotenv returns the variables as NAME=value lines of a .env file, as read by
+// Docker Compose and the dotenv libraries. Values are written without quotes if
+// possible, in single quotes (which are literal) if they contain no single quote
+// or line break, in double quotes with escaped \, ", $ and line breaks otherwise.
+// Variables whose names are not valid, like ProgramFiles(x86), are skipped.
+func (env *Environment) dotenv() string {
+	var sb strings.Builder
+	sb.WriteString("# Environment variables exported by peekenv\n")
+	for _, name := range env.Names() {
+		if !shellName.MatchString(name) {
+			fmt.Fprintf(&sb, "# skipped %s: not a valid variable name\n", name)
+			continue
+		}
+		fmt.Fprintf(&sb, "%s=%s\n", name, dotenvQuote(env.Variables[name].Value))
+	}
+	return sb.String()
+}
+
+// dotenvQuote returns the value quoted for a .env file, as described by dotenv.
+func dotenvQuote(s string) string {
+	switch {
+	case dotenvPlain.MatchString(s):
+		return s
+	case !strings.ContainsAny(s, "'\r\n"):
+		return "'" + s + "'"
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`, "\r", `\r`).Replace(s) + `"`
+}
+
+// IsDotenvFile reports whether a file name is a .env file, eg. ".env", ".env.local" or "prod.env".
+func IsDotenvFile(path string) bool {
+	base := strings.ToLower(filepath.Base(path))
+	return base == ".env" || strings.HasPrefix(base, ".env.") || filepath.Ext(base) == ".env"
+}
+
+// ParseDotenv reads the variables of a .env file. Lines may start with "export",
+// values may be unquoted (with trailing " # comments"), in single quotes (literal),
+// or in double quotes with backslash escapes, possibly spanning several lines.
+// Variable references like ${HOME} are not interpolated.
+//
+// Returns an error with the line number if a line is not a valid assignment.
+func ParseDotenv(r io.Reader) (map[string]string, error) {
+	env := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if lineNo == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("line %d: expected NAME=value", lineNo)
+		}
+		value = strings.TrimLeft(value, " \t")
+		start := lineNo
+
+		switch {
+		case strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "'"):
+			quote := value[:1]
+			value = value[1:]
+			// quoted values may span several lines
+			for closingQuote(value, quote) < 0 {
+				if !scanner.Scan() {
+					return nil, fmt.Errorf("line %d: missing closing quote %s", start, quote)
+				}
+				lineNo++
+				value += "\n" + scanner.Text()
+			}
+			end := closingQuote(value, quote)
+			if rest := strings.TrimSpace(value[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+				return nil, fmt.Errorf("line %d: unexpected %q after closing quote", lineNo, rest)
+			}
+			value = value[:end]
+			if quote == `"` {
+				value = unescapeDotenv(value)
+			}
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = value[:i]
+			}
+			value = strings.TrimSpace(value)
+		}
+		env[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// closingQuote returns the index of the closing quote in s, -1 if there is none.
+// In double quotes, a quote preceded by a backslash does not close the value.
+func closingQuote(s, quote string) int {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote == `"` && s[i] == '\\':
+			i++
+		case s[i] == quote[0]:
+			return i
+		}
+	}
+	return -1
+}
+
+// unescapeDotenv replaces the backslash escapes of a double-quoted value.
+// Unknown escapes are kept as is, so that Windows paths survive.
+func unescapeDotenv(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case '\\', '"', '$':
+			sb.WriteByte(s[i+1])
+		default:
+			sb.WriteByte('\\')
+			sb.WriteByte(s[i+1])
+		}
+		i++
+	}
+	return sb.String()
+}
@@ -0,0 +1,115 @@
+package envreg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnvironment_Dotenv(t *testing.T) {
+	env := &Environment{
+		Variables: map[string]Variable{
+			"JDBC":              {Value: "jdbc:x;user=sa", Type: REG_SZ, Hive: HKCU},
+			"OS":                {Value: "Windows_NT", Type: REG_SZ, Hive: HKLM},
+			"Path":              {Value: `C:\Windows;C:\Program Files\Git\cmd`, Type: REG_EXPAND_SZ, Hive: HKLM},
+			"PROMPT":            {Value: "$P$G", Type: REG_SZ, Hive: HKCU},
+			"QUOTE":             {Value: "it's \"quoted\"\nnext line", Type: REG_SZ, Hive: HKCU},
+			"ProgramFiles(x86)": {Value: `C:\Program Files (x86)`, Type: REG_SZ, Hive: HKLM},
+		},
+	}
+	expected := `# Environment variables exported by peekenv
+JDBC='jdbc:x;user=sa'
+OS=Windows_NT
+Path='C:\Windows;C:\Program Files\Git\cmd'
+# skipped ProgramFiles(x86): not a valid variable name
+PROMPT='$P$G'
+QUOTE="it's \"quoted\"\nnext line"
+`
+	if got := env.dotenv(); got != expected {
+		t.Errorf("dotenv() =\n%s\nwant\n%s", got, expected)
+	}
+}
+
+func TestParseDotenv(t *testing.T) {
+	input := "\ufeff# comment\n" +
+		"\n" +
+		"PLAIN=value # trailing comment\n" +
+		"export EXPORTED = spaced \n" +
+		"SINGLE='C:\\Temp\\$HOME \\n # not a comment'\n" +
+		"DOUBLE=\"tab\\tquote\\\" dollar\\$ path C:\\Temp\"\n" +
+		"MULTI=\"first\n" +
+		"second\" # comment\n" +
+		"EMPTY=\n" +
+		"HASH=a#b\n"
+	got, err := ParseDotenv(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseDotenv() error = %v", err)
+	}
+	expected := map[string]string{
+		"PLAIN":    "value",
+		"EXPORTED": "spaced",
+		"SINGLE":   `C:\Temp\$HOME \n # not a comment`,
+		"DOUBLE":   "tab\tquote\" dollar$ path C:\\Temp",
+		"MULTI":    "first\nsecond",
+		"EMPTY":    "",
+		"HASH":     "a#b",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("ParseDotenv() = %q, want %q", got, expected)
+	}
+}
+
+func TestParseDotenv_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{"missing equal sign", "A=1\nB\n", "line 2: expected NAME=value"},
+		{"space in name", "MY VAR=1\n", "line 1: expected NAME=value"},
+		{"unterminated quote", "A='open\nB=2\n", "line 1: missing closing quote '"},
+		{"text after quote", "A=\"x\" y\n", `line 1: unexpected "y" after closing quote`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseDotenv(strings.NewReader(tt.input))
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("ParseDotenv() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDotenv_RoundTrip(t *testing.T) {
+	values := map[string]string{
+		"A": `C:\Program Files\Java`,
+		"B": "it's $HOME # here",
+		"C": "line1\r\nline2 \\ \"q\"",
+		"D": "",
+		"E": "%USERPROFILE%\\bin;C:\\Tools",
+		"F": "'",
+	}
+	env := &Environment{Variables: toVariables(values)}
+	got, err := ParseDotenv(strings.NewReader(env.dotenv()))
+	if err != nil {
+		t.Fatalf("ParseDotenv() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, values) {
+		t.Errorf("round trip = %q, want %q", got, values)
+	}
+}
+
+func TestIsDotenvFile(t *testing.T) {
+	for path, expected := range map[string]bool{
+		".env":              true,
+		"config/.env.local": true,
+		`C:\app\prod.env`:   true,
+		"PROD.ENV":          true,
+		"before.txt":        false,
+		"environment":       false,
+	} {
+		if got := IsDotenvFile(path); got != expected {
+			t.Errorf("IsDotenvFile(%q) = %v, want %v", path, got, expected)
+		}
+	}
+}
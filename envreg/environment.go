@@ -0,0 +1,378 @@
+// Package envreg reads the environment variables stored in the Windows registry,
+// from the live registry or from exported .reg and offline hive files, merges the
+// system and user variables like Windows does, and writes them in several formats.
+package envreg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/tischda/peekenv/v3/section"
+)
+
+// Mode selects the hives environment variables are read from.
+type Mode int
+
+const (
+	Both    Mode = iota // system and user variables, user variables take precedence
+	Machine             // system variables only (HKEY_LOCAL_MACHINE)
+	User                // user variables only (HKEY_CURRENT_USER)
+)
+
+// ErrNotFound is returned by Read when no environment variable is found.
+var ErrNotFound = errors.New("no environment variables found")
+
+// Options configure how Read selects, merges and expands the variables. The zero
+// value reads all variables of both hives from the live registry, concatenating
+// the system and user values of Path and PsModulePath.
+type Options struct {
+	Mode       Mode
+	System     Source                      // source of the system variables, the live registry if nil
+	User       Source                      // source of the user variables, the live registry if nil
+	Variables  []string                    // names or patterns (see Filter) of the variables to read, all if empty
+	Exclude    []string                    // names or patterns of the variables not to read
+	Merge      MergePolicy                 // variables whose system and user values are concatenated
+	Expand     bool                        // expand %VAR% references in the values
+	LookupEnv  func(string) (string, bool) // fallback for expansion, eg. os.LookupEnv
+	AllowEmpty bool                        // return an empty environment instead of ErrNotFound when none of Variables is found
+}
+
+// Variable is an environment variable value with its registry value type and
+// the hive it was read from. Merged variables, like Path, come from both hives.
+type Variable struct {
+	Value    string
+	Type     uint32    // registry value type, eg. REG_EXPAND_SZ
+	Hive     Hive      // HKLM, HKCU, or both for merged variables
+	Parts    []Part    // values of each hive, for merged variables
+	Shadowed *Variable // system value overridden by the user value
+	sep      string    // separator of the entries of merged variables, semicolon if empty
+	multi    []string  // entries of REG_MULTI_SZ values, which may contain semicolons
+}
+
+// Part is the value of a merged variable read from one hive.
+type Part struct {
+	Hive  Hive
+	Value string
+	Type  uint32
+	multi []string // entries of REG_MULTI_SZ values
+}
+
+// part returns the value of a variable read from a single hive.
+func (v Variable) part() Part {
+	return Part{Hive: v.Hive, Value: v.Value, Type: v.Type, multi: v.multi}
+}
+
+// multiStrings returns the entries of a REG_MULTI_SZ value, as read from the
+// source. Otherwise the value is split on semicolons, without the quote handling
+// of SplitList, since the entries were joined without quotes.
+func (pt Part) multiStrings() []string {
+	if pt.multi != nil || pt.Value == "" {
+		return pt.multi
+	}
+	return strings.Split(pt.Value, ";")
+}
+
+// provenance returns the lines of the variable in the section format, preceded by
+// comments naming the hive of the entries that follow. A user value overriding a
+// system value is preceded by the shadowed system value. The entries of list
+// variables are written one per line, other values on a single line, quoted if
+// needed (see section.Quote).
+func (v Variable) provenance(list bool) []string {
+	var lines []string
+	if v.Shadowed != nil {
+		lines = append(lines, fmt.Sprintf("# %s, shadows %s value:", v.Hive, v.Shadowed.Hive))
+		for _, entry := range v.entries(v.Shadowed.Value, list) {
+			lines = append(lines, "#   "+section.Quote(entry))
+		}
+		return append(lines, quoteAll(v.entries(v.Value, list))...)
+	}
+	for _, pt := range v.hiveParts() {
+		lines = append(lines, "# "+pt.Hive.String())
+		lines = append(lines, quoteAll(v.entries(pt.Value, list))...)
+	}
+	return lines
+}
+
+// entries returns the entries of a value of the variable if it is a list (see
+// Entries), or the value as single entry otherwise.
+func (v Variable) entries(value string, list bool) []string {
+	if list {
+		return splitList(value, v.sep)
+	}
+	return []string{value}
+}
+
+// Entries returns the entries of the variable value: separated by the separator
+// of the merge policy for merged variables, like Path, by semicolons otherwise.
+// Semicolons between double quotes do not separate entries (see SplitList).
+func (v Variable) Entries() []string {
+	return splitList(v.Value, v.sep)
+}
+
+// quoteAll returns the lines representing the entries in the section format.
+// An empty value is a blank line, empty entries of lists are quoted since blank
+// lines are skipped when reading.
+func quoteAll(entries []string) []string {
+	if len(entries) == 1 && entries[0] == "" {
+		return entries
+	}
+	lines := make([]string, len(entries))
+	for i, entry := range entries {
+		lines[i] = section.Quote(entry)
+	}
+	return lines
+}
+
+// EntryHives returns the hive of each entry of the variable value.
+func (v Variable) EntryHives() []Hive {
+	var hives []Hive
+	for _, pt := range v.hiveParts() {
+		for range splitList(pt.Value, v.sep) {
+			hives = append(hives, pt.Hive)
+		}
+	}
+	return hives
+}
+
+// hiveParts returns the parts of a merged variable, or a single part for other variables.
+func (v Variable) hiveParts() []Part {
+	if len(v.Parts) > 0 {
+		return v.Parts
+	}
+	return []Part{v.part()}
+}
+
+// HiveValues returns the value of the variable in each hive it was read from,
+// system value first: the parts of a merged variable, the shadowed system value
+// and the user value, or the value of a variable defined in a single hive.
+func (v Variable) HiveValues() []Part {
+	if v.Shadowed != nil {
+		return []Part{v.Shadowed.part(), v.part()}
+	}
+	parts := slices.Clone(v.hiveParts())
+	sort.SliceStable(parts, func(i, j int) bool {
+		return parts[i].Hive < parts[j].Hive
+	})
+	return parts
+}
+
+// Environment is a set of environment variables read by Read.
+type Environment struct {
+	Mode       Mode                // hives the variables were read from
+	Variables  map[string]Variable // variables keyed by name
+	Merge      MergePolicy         // variables whose system and user values were concatenated
+	Unreadable []error             // values that could not be read
+	Unmatched  []string            // names and patterns of Options.Variables and Options.Exclude that matched no variable
+	Missing    []string            // names and patterns of Options.Variables that matched no variable
+	lookupEnv  func(string) (string, bool)
+	all        map[string]string // values of all the variables read, selected or not, for expansion
+	selected   map[string]bool   // lower-case names of the variables selected by the filter
+}
+
+// Read reads the environment variables from the system and user sources.
+// Values that cannot be read are skipped and collected in Environment.Unreadable.
+//
+// Parameters:
+//   - ctx: cancels reading between two values
+//   - opts: the sources, variables, merge policy and expansion to apply
+//
+// Returns an error if a source cannot be read, a pattern is invalid, or no
+// environment variables are found (ErrNotFound, unless opts.AllowEmpty is set
+// and variables were requested).
+func Read(ctx context.Context, opts Options) (*Environment, error) {
+	filter, err := NewFilter(opts.Variables, opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	system, user := opts.System, opts.User
+	if system == nil {
+		system = NewRegistrySource(HKLM)
+	}
+	if user == nil {
+		user = NewRegistrySource(HKCU)
+	}
+
+	env := &Environment{
+		Mode:      opts.Mode,
+		Variables: make(map[string]Variable),
+		Merge:     opts.Merge,
+		lookupEnv: opts.LookupEnv,
+		selected:  make(map[string]bool),
+	}
+	switch opts.Mode {
+	case User:
+		if err := env.read(ctx, user, filter, false); err != nil {
+			return nil, fmt.Errorf("reading user environment variables: %w", err)
+		}
+	case Machine:
+		if err := env.read(ctx, system, filter, false); err != nil {
+			return nil, fmt.Errorf("reading system environment variables: %w", err)
+		}
+	default:
+		// order matters, first system, then user (so user can override)
+		if err := env.read(ctx, system, filter, false); err != nil {
+			return nil, fmt.Errorf("reading system environment variables: %w", err)
+		}
+		if err := env.read(ctx, user, filter, true); err != nil {
+			return nil, fmt.Errorf("reading user environment variables: %w", err)
+		}
+	}
+	env.Unmatched = filter.Unmatched()
+	env.Missing = filter.Missing()
+
+	// references resolve against all the variables read, the filter only selects
+	// the variables returned
+	env.all = make(map[string]string, len(env.Variables))
+	for k, v := range env.Variables {
+		env.all[k] = v.Value
+		if !env.selected[strings.ToLower(k)] {
+			delete(env.Variables, k)
+		}
+	}
+
+	if len(env.Variables) == 0 && len(opts.Variables) == 0 {
+		return nil, ErrNotFound
+	}
+	if len(env.Variables) == 0 && !opts.AllowEmpty {
+		return nil, fmt.Errorf("%w matching %s", ErrNotFound, strings.Join(opts.Variables, ", "))
+	}
+
+	if opts.Expand {
+		e := env.Expander()
+		for k, v := range env.Variables {
+			v.Value = e.Expand(v.Value)
+			v.multi = expandAll(e, v.multi)
+			for i := range v.Parts {
+				v.Parts[i].Value = e.Expand(v.Parts[i].Value)
+				v.Parts[i].multi = expandAll(e, v.Parts[i].multi)
+			}
+			if v.Shadowed != nil {
+				v.Shadowed.Value = e.Expand(v.Shadowed.Value)
+				v.Shadowed.multi = expandAll(e, v.Shadowed.multi)
+			}
+			env.Variables[k] = v
+		}
+	}
+	return env, nil
+}
+
+// read reads all the environment variables from the provided source, and records
+// the names of those selected by filter in env.selected.
+//
+// Parameters:
+//   - ctx: cancels reading between two values
+//   - src: the source to read variables from
+//   - filter: selects the variables returned by Read
+//   - mergePaths: if true, merges variables matching env.Merge with existing values in env.Variables
+//
+// Merging presupposes that env.Variables has already been initialized with SYSTEM variables.
+// Therefore, read the system source before calling this with mergePaths=true.
+//
+// Values that cannot be read are not added to env.Variables and do not match the
+// filter, so requested variables are reported as missing. Those of selected
+// variables are collected in env.Unreadable.
+//
+// Returns an error if the variable names cannot be read or ctx is canceled.
+func (env *Environment) read(ctx context.Context, src Source, filter *Filter, mergePaths bool) error {
+	names, err := src.Names()
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		val, valtype, verr := src.Value(name)
+		var multi []string
+		if ms, ok := src.(MultiStringSource); ok && verr == nil && valtype == REG_MULTI_SZ {
+			// the entries may contain the semicolons joining them in val
+			multi, verr = ms.Strings(name)
+		}
+		if verr != nil {
+			// a variable that cannot be read does not match the requested names
+			if filter.selects(name, false) {
+				env.Unreadable = append(env.Unreadable, fmt.Errorf("reading %s\\%s: %w", src.Hive(), name, verr))
+			}
+			continue
+		}
+		if filter.Selects(name) {
+			env.selected[strings.ToLower(name)] = true
+		}
+		current := Variable{Value: val, Type: valtype, Hive: src.Hive(), multi: multi}
+		if env.Merge.Merges(name) {
+			current.sep = env.Merge.Separator()
+		}
+		key, existing, exists := env.lookup(name)
+		switch {
+		case !exists:
+			env.Variables[name] = current
+		case mergePaths && env.Merge.Merges(name):
+			// Concatenate USER and SYSTEM values, in the order defined by the policy
+			merged := existing
+			merged.Value, merged.Parts = env.Merge.join(
+				existing.part(),
+				current.part(),
+			)
+			if merged.Type != REG_EXPAND_SZ {
+				// the merged value needs expansion if any part does
+				merged.Type = valtype
+			}
+			merged.Hive |= src.Hive()
+			env.Variables[key] = merged
+		default:
+			current.Shadowed = &existing
+			delete(env.Variables, key)
+			env.Variables[name] = current
+		}
+	}
+	return err
+}
+
+// Names returns the variable names in alphabetical order (case-insensitive),
+// for consistent output.
+func (env *Environment) Names() []string {
+	names := make([]string, 0, len(env.Variables))
+	for k := range env.Variables {
+		names = append(names, k)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return strings.ToLower(names[i]) < strings.ToLower(names[j])
+	})
+	return names
+}
+
+// Lookup returns the variable with the specified name, ignoring case.
+func (env *Environment) Lookup(name string) (Variable, bool) {
+	_, v, ok := env.lookup(name)
+	return v, ok
+}
+
+// lookup returns the variable with the specified name (case-insensitive) and
+// its name in env.Variables.
+func (env *Environment) lookup(name string) (string, Variable, bool) {
+	if v, ok := env.Variables[name]; ok {
+		return name, v, true
+	}
+	for k, v := range env.Variables {
+		if strings.EqualFold(k, name) {
+			return k, v, true
+		}
+	}
+	return "", Variable{}, false
+}
+
+// Expander returns an expander resolving references against all the variables
+// read from the selected hives, including those not selected by Options.Variables
+// or Options.Exclude, and falling back to Options.LookupEnv for variables that are
+// not in the registry.
+func (env *Environment) Expander() *Expander {
+	vars := env.all
+	if vars == nil {
+		vars = make(map[string]string, len(env.Variables))
+		for k, v := range env.Variables {
+			vars[k] = v.Value
+		}
+	}
+	return NewExpander(vars, env.lookupEnv)
+}
@@ -0,0 +1,454 @@
+package envreg
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/tischda/peekenv/v3/envreg/envregtest"
+	"github.com/tischda/peekenv/v3/section"
+)
+
+func TestEnvironment_String(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   map[string]string
+		expected string
+	}{
+		{
+			name: "single variable",
+			values: map[string]string{
+				"TEMP": "C:\\Temp",
+			},
+			expected: "[TEMP]\nC:\\Temp\n",
+		},
+		{
+			name: "multiple variables",
+			values: map[string]string{
+				"TEMP": "C:\\Temp",
+				"USER": "johndoe",
+			},
+			expected: "[TEMP]\nC:\\Temp\n\n[USER]\njohndoe\n",
+		},
+		{
+			name: "Path variable with semicolons",
+			values: map[string]string{
+				"Path": "C:\\Windows\\System32;C:\\Windows;C:\\Program Files\\Git\\bin",
+			},
+			expected: "[Path]\nC:\\Windows\\System32\nC:\\Windows\nC:\\Program Files\\Git\\bin\n",
+		},
+		{
+			name: "Path and other variables",
+			values: map[string]string{
+				"Path": "C:\\Windows;C:\\Program Files",
+				"TEMP": "C:\\Temp",
+			},
+			expected: "[Path]\nC:\\Windows\nC:\\Program Files\n\n[TEMP]\nC:\\Temp\n",
+		},
+		{
+			name:     "empty map",
+			values:   map[string]string{},
+			expected: "\n",
+		},
+		{
+			name: "variable with empty value",
+			values: map[string]string{
+				"EMPTY": "",
+			},
+			expected: "[EMPTY]\n\n",
+		},
+		{
+			name: "semicolons in other variables",
+			values: map[string]string{
+				"JDBC_URL": "jdbc:sqlserver://db;databaseName=app",
+			},
+			expected: "[JDBC_URL]\njdbc:sqlserver://db;databaseName=app\n",
+		},
+		{
+			name: "Path entry with quoted semicolon",
+			values: map[string]string{
+				"Path": `C:\a;"C:\My;Tools";C:\b`,
+			},
+			expected: "[Path]\nC:\\a\n\"C:\\My;Tools\"\nC:\\b\n",
+		},
+		{
+			name: "quoted entries",
+			values: map[string]string{
+				"Path": "C:\\a;[C:\\b]",
+			},
+			expected: "# peekenv-format: 2\n\n[Path]\nC:\\a\n`\"[C:\\\\b]\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &Environment{Variables: toVariables(tt.values)}
+			result := env.String()
+
+			// For tests with multiple variables, we need to handle the fact that
+			// map iteration order is not guaranteed in Go
+			if len(tt.values) > 1 && !strings.Contains(tt.name, "Path") {
+				// Check that all expected sections are present
+				for key, value := range tt.values {
+					expectedSection := "[" + key + "]\n" + value
+					if !strings.Contains(result, expectedSection) {
+						t.Errorf("String() = %q, missing section for %s", result, key)
+					}
+				}
+				// Check that result ends with newline
+				if !strings.HasSuffix(result, "\n") {
+					t.Errorf("String() = %q, should end with newline", result)
+				}
+			} else {
+				// For single variable or Path tests, we can do exact comparison
+				if result != tt.expected {
+					t.Errorf("String() = %q, want %q", result, tt.expected)
+				}
+			}
+		})
+	}
+}
+
+// toVariables converts plain values to REG_SZ variables read from HKLM.
+func toVariables(values map[string]string) map[string]Variable {
+	vars := make(map[string]Variable, len(values))
+	for k, v := range values {
+		vars[k] = Variable{Value: v, Type: REG_SZ, Hive: HKLM}
+	}
+	return vars
+}
+
+// fixtureSources returns in-memory system and user sources with typical values.
+func fixtureSources() (*MemSource, *MemSource) {
+	system, user := NewMemSource(HKLM), NewMemSource(HKCU)
+	envregtest.Fill(system, user)
+	return system, user
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      Mode
+		variables []string
+		exclude   []string
+		expected  map[string]string
+	}{
+		{
+			name: "both merges paths and user overrides system",
+			mode: Both,
+			expected: map[string]string{
+				"OS":           "Windows_NT",
+				"Path":         `%SystemRoot%\system32;%SystemRoot%;%USERPROFILE%\AppData\Local\Microsoft\WindowsApps`,
+				"PsModulePath": `%ProgramFiles%\WindowsPowerShell\Modules`,
+				"TEMP":         `%USERPROFILE%\AppData\Local\Temp`,
+				"M2_HOME":      `c:\usr\bin\maven`,
+			},
+		},
+		{
+			name: "machine only",
+			mode: Machine,
+			expected: map[string]string{
+				"OS":           "Windows_NT",
+				"Path":         `%SystemRoot%\system32;%SystemRoot%`,
+				"PsModulePath": `%ProgramFiles%\WindowsPowerShell\Modules`,
+				"TEMP":         `%SystemRoot%\TEMP`,
+			},
+		},
+		{
+			name: "user only",
+			mode: User,
+			expected: map[string]string{
+				"Path":    `%USERPROFILE%\AppData\Local\Microsoft\WindowsApps`,
+				"TEMP":    `%USERPROFILE%\AppData\Local\Temp`,
+				"M2_HOME": `c:\usr\bin\maven`,
+			},
+		},
+		{
+			name:      "filter is case-insensitive",
+			mode:      Both,
+			variables: []string{"os", "m2_home"},
+			expected: map[string]string{
+				"OS":      "Windows_NT",
+				"M2_HOME": `c:\usr\bin\maven`,
+			},
+		},
+		{
+			name:      "glob and regex patterns",
+			mode:      Both,
+			variables: []string{"*_home", "re:^p.*path$"},
+			expected: map[string]string{
+				"M2_HOME":      `c:\usr\bin\maven`,
+				"PsModulePath": `%ProgramFiles%\WindowsPowerShell\Modules`,
+			},
+		},
+		{
+			name:    "exclude patterns",
+			mode:    Both,
+			exclude: []string{"*PATH", "re:^te"},
+			expected: map[string]string{
+				"OS":      "Windows_NT",
+				"M2_HOME": `c:\usr\bin\maven`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			system, user := fixtureSources()
+			env, err := Read(context.Background(), Options{
+				Mode:      tt.mode,
+				Variables: tt.variables,
+				Exclude:   tt.exclude,
+				System:    system,
+				User:      user,
+			})
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if len(env.Variables) != len(tt.expected) {
+				t.Errorf("Read() got %d variables, want %d: %v", len(env.Variables), len(tt.expected), env.Variables)
+			}
+			for k, v := range tt.expected {
+				if env.Variables[k].Value != v {
+					t.Errorf("Variables[%s] = %q, want %q", k, env.Variables[k].Value, v)
+				}
+			}
+		})
+	}
+}
+
+func TestRead_Hive(t *testing.T) {
+	system, user := fixtureSources()
+	env, err := Read(context.Background(), Options{
+		System: system,
+		User:   user,
+	})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	expected := map[string]Variable{
+		"OS":      {Value: "Windows_NT", Type: REG_SZ, Hive: HKLM},
+		"TEMP":    {Value: `%USERPROFILE%\AppData\Local\Temp`, Type: REG_EXPAND_SZ, Hive: HKCU},
+		"M2_HOME": {Value: `c:\usr\bin\maven`, Type: REG_SZ, Hive: HKCU},
+	}
+	for k, v := range expected {
+		got := env.Variables[k]
+		if got.Value != v.Value || got.Type != v.Type || got.Hive != v.Hive {
+			t.Errorf("Variables[%s] = %+v, want %+v", k, got, v)
+		}
+	}
+	if got := env.Variables["Path"]; got.Hive != HKLM|HKCU || got.Type != REG_EXPAND_SZ {
+		t.Errorf("merged Path = %+v, want hive HKLM+HKCU and type REG_EXPAND_SZ", got)
+	}
+}
+
+func TestRead_NotFound(t *testing.T) {
+	system, user := fixtureSources()
+	opts := Options{
+		Variables: []string{"DOES_NOT_EXIST"},
+		System:    system,
+		User:      user,
+	}
+	if _, err := Read(context.Background(), opts); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read() error = %v, want ErrNotFound", err)
+	}
+
+	opts.AllowEmpty = true
+	env, err := Read(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Read() error = %v, want empty environment", err)
+	}
+	if len(env.Variables) != 0 || !slices.Equal(env.Missing, []string{"DOES_NOT_EXIST"}) {
+		t.Errorf("Read() = %v, missing %v, want no variables and DOES_NOT_EXIST missing", env.Variables, env.Missing)
+	}
+}
+
+func TestRead_Unmatched(t *testing.T) {
+	system, user := fixtureSources()
+	env, err := Read(context.Background(), Options{
+		Variables: []string{"os", "JAVA_*", "M2_HOME"},
+		Exclude:   []string{"re:^GO"},
+		System:    system,
+		User:      user,
+	})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if !slices.Equal(env.Unmatched, []string{"JAVA_*", "re:^GO"}) {
+		t.Errorf("Unmatched = %v, want [JAVA_* re:^GO]", env.Unmatched)
+	}
+	if !slices.Equal(env.Missing, []string{"JAVA_*"}) {
+		t.Errorf("Missing = %v, want [JAVA_*]", env.Missing)
+	}
+
+	if _, err := Read(context.Background(), Options{Variables: []string{"re:("}, System: system, User: user}); err == nil {
+		t.Error("Read() should fail with an invalid pattern")
+	}
+}
+
+// roundTrips reports whether a variable can be represented in the section format:
+// values are quoted as needed, but names must fit on a line.
+func roundTrips(name, value string) bool {
+	return name != "" && !strings.ContainsAny(name, "\r\n")
+}
+
+func FuzzEnvironment_String_RoundTrip(f *testing.F) {
+	f.Add("TEMP", `C:\Temp`, "Path", `C:\Windows\System32;C:\Windows`)
+	f.Add("EMPTY", "", "Path", ";;C:\\a;")
+	f.Add("A", "x", "B", "")
+	f.Add("ProgramFiles(x86)", `C:\Program Files (x86)`, "PROMPT", "$P$G")
+	f.Add("JDBC_URL", "jdbc:db;user=sa", "Path", "[a];# b;`c")
+	f.Add("MULTILINE", "line1\r\nline2", "Path", "a\nb;c")
+
+	f.Fuzz(func(t *testing.T, name1, value1, name2, value2 string) {
+		if !roundTrips(name1, value1) || !roundTrips(name2, value2) || strings.EqualFold(name1, name2) {
+			t.Skip()
+		}
+		env := &Environment{Variables: toVariables(map[string]string{name1: value1, name2: value2})}
+
+		vars, err := section.Parse(strings.NewReader(env.String()))
+		if err != nil {
+			t.Fatalf("Parse(String()) error = %v\n%q", err, env.String())
+		}
+		got := make(map[string]string, len(vars))
+		for _, v := range vars {
+			got[v.Name] = v.Value
+		}
+		expected := map[string]string{name1: value1, name2: value2}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("Parse(String()) = %q, want %q", got, expected)
+		}
+	})
+}
+
+func TestRead_Unreadable(t *testing.T) {
+	system, user := fixtureSources()
+	system.fail("BROKEN", errors.New("access denied"))
+	user.Set("COUNT", "42", REG_DWORD)
+	env, err := Read(context.Background(), Options{
+		System: system,
+		User:   user,
+	})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	if _, ok := env.Variables["BROKEN"]; ok {
+		t.Error("unreadable value should not be exported")
+	}
+	if len(env.Unreadable) != 1 || !strings.Contains(env.Unreadable[0].Error(), `HKLM\BROKEN`) {
+		t.Errorf("Unreadable = %v, want error for HKLM\\BROKEN", env.Unreadable)
+	}
+	if got := env.Variables["COUNT"]; got.Value != "42" || got.Type != REG_DWORD {
+		t.Errorf("COUNT = %+v, want REG_DWORD 42", got)
+	}
+}
+
+func TestRead_UnreadableMissing(t *testing.T) {
+	system, user := fixtureSources()
+	system.fail("BROKEN", errors.New("access denied"))
+	env, err := Read(context.Background(), Options{
+		System:     system,
+		User:       user,
+		Variables:  []string{"BROKEN", "OS"},
+		AllowEmpty: true,
+	})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(env.Missing, []string{"BROKEN"}) {
+		t.Errorf("Missing = %v, want [BROKEN]", env.Missing)
+	}
+	if len(env.Unreadable) != 1 {
+		t.Errorf("Unreadable = %v, want error for HKLM\\BROKEN", env.Unreadable)
+	}
+	if _, ok := env.Variables["OS"]; !ok || len(env.Variables) != 1 {
+		t.Errorf("Variables = %v, want OS only", env.Variables)
+	}
+}
+
+func TestEnvironment_Text_Types(t *testing.T) {
+	env := &Environment{
+		Variables: map[string]Variable{
+			"Path":  {Value: `%SystemRoot%;C:\bin`, Type: REG_EXPAND_SZ, Hive: HKLM},
+			"COUNT": {Value: "42", Type: REG_DWORD, Hive: HKCU},
+		},
+	}
+	expected := "[COUNT] REG_DWORD\n42\n\n[Path] REG_EXPAND_SZ\n%SystemRoot%\nC:\\bin\n"
+	if got := env.text(FormatOptions{Types: true}); got != expected {
+		t.Errorf("text() = %q, want %q", got, expected)
+	}
+
+	vars, err := section.Parse(strings.NewReader(expected))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if vars[1].Type != "REG_EXPAND_SZ" {
+		t.Errorf("Parse() type = %q, want REG_EXPAND_SZ", vars[1].Type)
+	}
+}
+
+func TestEnvironment_Text_Provenance(t *testing.T) {
+	system, user := fixtureSources()
+	env, err := Read(context.Background(), Options{
+		Variables: []string{"Path", "TEMP", "OS"},
+		System:    system,
+		User:      user,
+	})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	expected := `[OS]
+# HKLM
+Windows_NT
+
+[Path]
+# HKLM
+%SystemRoot%\system32
+%SystemRoot%
+# HKCU
+%USERPROFILE%\AppData\Local\Microsoft\WindowsApps
+
+[TEMP]
+# HKCU, shadows HKLM value:
+#   %SystemRoot%\TEMP
+%USERPROFILE%\AppData\Local\Temp
+`
+	got := env.text(FormatOptions{Provenance: true})
+	if got != expected {
+		t.Errorf("text() =\n%s\nwant:\n%s", got, expected)
+	}
+
+	// annotations are comments, the output is still valid input for pokenv
+	vars, err := section.Parse(strings.NewReader(got))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	for _, v := range vars {
+		if v.Value != env.Variables[v.Name].Value {
+			t.Errorf("Parse() %s = %q, want %q", v.Name, v.Value, env.Variables[v.Name].Value)
+		}
+	}
+}
+
+func TestRead_UserOnlyPath(t *testing.T) {
+	system := NewMemSource(HKLM)
+	user := NewMemSource(HKCU)
+	user.Set("Path", `C:\bin`, REG_SZ)
+	env, err := Read(context.Background(), Options{
+		System: system,
+		User:   user,
+	})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if got := env.Variables["Path"]; got.Value != `C:\bin` || got.Hive != HKCU {
+		t.Errorf("Path = %+v, want user value without separator", got)
+	}
+}
@@ -0,0 +1,27 @@
+// Package envregtest provides the environment variables used as fixture data by
+// the tests, so that the tests of envreg and of its users read the same values.
+package envregtest
+
+// Registry value types of the fixture values, as defined by envreg.
+const (
+	regSZ       uint32 = 1
+	regExpandSZ uint32 = 2
+)
+
+// Setter stores variables in a source, like envreg.MemSource.
+type Setter interface {
+	Set(name, value string, valtype uint32)
+}
+
+// Fill stores typical system and user variables in the sources: Path and TEMP
+// are defined in both hives, with references to other variables.
+func Fill(system, user Setter) {
+	system.Set("OS", "Windows_NT", regSZ)
+	system.Set("Path", `%SystemRoot%\system32;%SystemRoot%`, regExpandSZ)
+	system.Set("PsModulePath", `%ProgramFiles%\WindowsPowerShell\Modules`, regExpandSZ)
+	system.Set("TEMP", `%SystemRoot%\TEMP`, regExpandSZ)
+
+	user.Set("Path", `%USERPROFILE%\AppData\Local\Microsoft\WindowsApps`, regExpandSZ)
+	user.Set("TEMP", `%USERPROFILE%\AppData\Local\Temp`, regExpandSZ)
+	user.Set("M2_HOME", `c:\usr\bin\maven`, regSZ)
+}
@@ -0,0 +1,114 @@
+package envreg
+
+import (
+	"strings"
+)
+
+// Expander resolves %VAR% references like ExpandEnvironmentStringsW, but against
+// an explicit set of variables (eg. the variables read from the registry) instead
+// of the environment of the current process. Values are expanded recursively,
+// references that cannot be resolved are left intact.
+type Expander struct {
+	vars     map[string]string                // variable values, keyed by upper-case name
+	fallback func(name string) (string, bool) // lookup for variables not in vars, may be nil
+	active   map[string]bool                  // variables being expanded, to detect cycles
+	cache    map[string]string                // expanded values
+	cycles   int                              // number of cycles detected so far
+}
+
+// NewExpander returns an expander resolving references against vars.
+//
+// Parameters:
+//   - vars: the variables, keyed by name (case-insensitive)
+//   - fallback: lookup for variables not in vars, eg. os.LookupEnv, or nil.
+//     Values returned by fallback are not expanded further.
+func NewExpander(vars map[string]string, fallback func(string) (string, bool)) *Expander {
+	e := &Expander{
+		vars:     make(map[string]string, len(vars)),
+		fallback: fallback,
+		active:   make(map[string]bool),
+		cache:    make(map[string]string),
+	}
+	for k, v := range vars {
+		e.vars[strings.ToUpper(k)] = v
+	}
+	return e
+}
+
+// Expand returns s with all resolvable %VAR% references replaced by their values.
+//
+// Like ExpandEnvironmentStringsW, when %A% cannot be resolved in "%A%B%", "%A" is
+// kept and the closing '%' may start the next reference "%B%".
+func (e *Expander) Expand(s string) string {
+	var sb strings.Builder
+	for {
+		start := strings.IndexByte(s, '%')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(s[start+1:], '%')
+		if end < 0 {
+			break
+		}
+		end += start + 1
+
+		value, ok := e.resolve(s[start+1 : end])
+		if !ok {
+			sb.WriteString(s[:end])
+			s = s[end:]
+			continue
+		}
+		sb.WriteString(s[:start])
+		sb.WriteString(value)
+		s = s[end+1:]
+	}
+	sb.WriteString(s)
+	return sb.String()
+}
+
+// expandAll returns the entries with their %VAR% references expanded, nil if
+// there are none.
+func expandAll(e *Expander, entries []string) []string {
+	if entries == nil {
+		return nil
+	}
+	expanded := make([]string, len(entries))
+	for i, entry := range entries {
+		expanded[i] = e.Expand(entry)
+	}
+	return expanded
+}
+
+// resolve returns the expanded value of the named variable. A variable referencing
+// itself, directly or through other variables, cannot be resolved.
+func (e *Expander) resolve(name string) (string, bool) {
+	if name == "" {
+		return "", false
+	}
+	key := strings.ToUpper(name)
+	if value, ok := e.cache[key]; ok {
+		return value, true
+	}
+	if e.active[key] {
+		e.cycles++
+		return "", false
+	}
+	raw, ok := e.vars[key]
+	if !ok {
+		if e.fallback == nil {
+			return "", false
+		}
+		return e.fallback(name)
+	}
+
+	e.active[key] = true
+	cycles := e.cycles
+	value := e.Expand(raw)
+	delete(e.active, key)
+
+	// values truncated by a cycle depend on where the expansion started
+	if e.cycles == cycles {
+		e.cache[key] = value
+	}
+	return value, true
+}
@@ -0,0 +1,113 @@
+package envreg
+
+import (
+	"context"
+	"testing"
+)
+
+func TestExpander_Expand(t *testing.T) {
+	vars := map[string]string{
+		"SystemRoot":   `C:\Windows`,
+		"ProgramFiles": `C:\Program Files`,
+		"JAVA_HOME":    `%ProgramFiles%\Java\jdk-21`,
+		"Path":         `%SystemRoot%\system32;%JAVA_HOME%\bin;%Path%`,
+		"A":            "a%B%",
+		"B":            "b%A%",
+		"EMPTY":        "",
+	}
+	fallback := func(name string) (string, bool) {
+		if name == "USERPROFILE" {
+			return `C:\Users\%USERNAME%`, true
+		}
+		return "", false
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "no reference", input: `C:\Temp`, expected: `C:\Temp`},
+		{name: "simple", input: `%SystemRoot%\TEMP`, expected: `C:\Windows\TEMP`},
+		{name: "case-insensitive", input: `%systemroot%`, expected: `C:\Windows`},
+		{name: "recursive", input: `%JAVA_HOME%\bin`, expected: `C:\Program Files\Java\jdk-21\bin`},
+		{name: "unknown left intact", input: `%UNKNOWN%\bin`, expected: `%UNKNOWN%\bin`},
+		{name: "unknown followed by reference", input: `%UNKNOWN%SystemRoot%`, expected: `%UNKNOWNC:\Windows`},
+		{name: "empty value", input: `x%EMPTY%y`, expected: `xy`},
+		{name: "double percent", input: `100%%`, expected: `100%%`},
+		{name: "unterminated", input: `50%SystemRoot`, expected: `50%SystemRoot`},
+		{name: "self reference", input: `%Path%`, expected: `C:\Windows\system32;C:\Program Files\Java\jdk-21\bin;%Path%`},
+		{name: "cycle", input: `%A%`, expected: `ab%A%`},
+		{name: "fallback is not expanded", input: `%USERPROFILE%\bin`, expected: `C:\Users\%USERNAME%\bin`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewExpander(vars, fallback)
+			if got := e.Expand(tt.input); got != tt.expected {
+				t.Errorf("expand(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExpander_CycleNotCached(t *testing.T) {
+	e := NewExpander(map[string]string{"A": "a%B%", "B": "b%A%"}, nil)
+	if got := e.Expand("%A%"); got != "ab%A%" {
+		t.Errorf("expand(%%A%%) = %q, want %q", got, "ab%A%")
+	}
+	if got := e.Expand("%B%"); got != "ba%B%" {
+		t.Errorf("expand(%%B%%) = %q, want %q", got, "ba%B%")
+	}
+}
+
+func TestRead_Expand(t *testing.T) {
+	system, user := fixtureSources()
+	system.Set("SystemRoot", `C:\Windows`, REG_SZ)
+	user.Set("USERPROFILE", `C:\Users\john`, REG_SZ)
+	env, err := Read(context.Background(), Options{
+		Variables: []string{"Path", "TEMP", "SystemRoot", "USERPROFILE"},
+		System:    system,
+		User:      user,
+		Expand:    true,
+	})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	expected := `C:\Windows\system32;C:\Windows;C:\Users\john\AppData\Local\Microsoft\WindowsApps`
+	if got := env.Variables["Path"].Value; got != expected {
+		t.Errorf("Path = %q, want %q", got, expected)
+	}
+	if got := env.Variables["Path"].Parts[1].Value; got != `C:\Users\john\AppData\Local\Microsoft\WindowsApps` {
+		t.Errorf("Path user part = %q, want expanded value", got)
+	}
+	if got := env.Variables["TEMP"].Shadowed.Value; got != `C:\Windows\TEMP` {
+		t.Errorf("TEMP shadowed = %q, want expanded value", got)
+	}
+}
+
+func TestRead_ExpandUnselected(t *testing.T) {
+	system := NewMemSource(HKLM)
+	system.Set("JAVA_HOME", `C:\jdk`, REG_SZ)
+	system.Set("Path", `%JAVA_HOME%\bin;C:\Windows`, REG_EXPAND_SZ)
+	user := NewMemSource(HKCU)
+	user.Set("TOOLS", `C:\tools`, REG_SZ)
+	user.Set("Path", `%TOOLS%`, REG_EXPAND_SZ)
+	env, err := Read(context.Background(), Options{
+		Variables: []string{"Path"},
+		Exclude:   []string{"TOOLS"},
+		System:    system,
+		User:      user,
+		Expand:    true,
+	})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(env.Variables) != 1 {
+		t.Errorf("Read() = %d variables, want only Path", len(env.Variables))
+	}
+	if got := env.Variables["Path"].Value; got != `C:\jdk\bin;C:\Windows;C:\tools` {
+		t.Errorf("Path = %q, want references to unselected variables expanded", got)
+	}
+}
@@ -0,0 +1,130 @@
+package envreg
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// RegexPrefix marks a pattern as a regular expression, eg. re:^VS\d+COMNTOOLS$.
+const RegexPrefix = "re:"
+
+// namePattern selects variables by name: an exact name, a glob pattern (eg. JAVA_*
+// or *_HOME), or a regular expression prefixed with "re:". Names are matched
+// case-insensitively, like in the registry.
+type namePattern struct {
+	text string
+	re   *regexp.Regexp // nil for names and glob patterns
+}
+
+// compilePatterns returns the patterns of a list of names, globs and regular expressions.
+//
+// Returns an error if a glob pattern or regular expression is invalid.
+func compilePatterns(list []string) ([]namePattern, error) {
+	patterns := make([]namePattern, 0, len(list))
+	for _, text := range list {
+		np := namePattern{text: text}
+		if expr, ok := strings.CutPrefix(text, RegexPrefix); ok {
+			re, err := regexp.Compile("(?i)" + expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", text, err)
+			}
+			np.re = re
+		} else if _, err := path.Match(text, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", text, err)
+		}
+		patterns = append(patterns, np)
+	}
+	return patterns, nil
+}
+
+// matches reports whether a variable name matches the pattern.
+func (np namePattern) matches(name string) bool {
+	if np.re != nil {
+		return np.re.MatchString(name)
+	}
+	return matchName(np.text, name)
+}
+
+// Filter selects the variables to read from all sources, and remembers which
+// patterns matched a variable.
+type Filter struct {
+	include []namePattern // all variables are selected if empty
+	exclude []namePattern
+	matched map[string]bool
+}
+
+// NewFilter returns a filter selecting the variables matching one of the
+// include patterns (or all variables if there are none) and none of the exclude
+// patterns.
+//
+// Returns an error if a pattern is invalid.
+func NewFilter(include, exclude []string) (*Filter, error) {
+	in, err := compilePatterns(include)
+	if err != nil {
+		return nil, err
+	}
+	ex, err := compilePatterns(exclude)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{include: in, exclude: ex, matched: make(map[string]bool)}, nil
+}
+
+// Selects reports whether the named variable is selected, and records the
+// patterns matching it.
+func (f *Filter) Selects(name string) bool {
+	return f.selects(name, true)
+}
+
+// selects reports whether the named variable is selected. If record is true,
+// the patterns matching it are recorded, so that they are not reported as
+// unmatched.
+func (f *Filter) selects(name string, record bool) bool {
+	included := len(f.include) == 0
+	for _, np := range f.include {
+		if np.matches(name) {
+			if record {
+				f.matched[np.text] = true
+			}
+			included = true
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, np := range f.exclude {
+		if np.matches(name) {
+			if record {
+				f.matched[np.text] = true
+			}
+			included = false
+		}
+	}
+	return included
+}
+
+// Unmatched returns the include and exclude patterns that matched no variable,
+// in the order they were given.
+func (f *Filter) Unmatched() []string {
+	return f.unmatchedOf(slices.Concat(f.include, f.exclude))
+}
+
+// Missing returns the include patterns that matched no variable, ie. the
+// requested variables that were not found.
+func (f *Filter) Missing() []string {
+	return f.unmatchedOf(f.include)
+}
+
+// unmatchedOf returns the texts of the patterns that matched no variable.
+func (f *Filter) unmatchedOf(patterns []namePattern) []string {
+	var texts []string
+	for _, np := range patterns {
+		if !f.matched[np.text] {
+			texts = append(texts, np.text)
+		}
+	}
+	return texts
+}
@@ -0,0 +1,99 @@
+package envreg
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCompilePatterns_Invalid(t *testing.T) {
+	for _, pattern := range []string{"[", "JAVA_[", "re:(", "re:a**"} {
+		if _, err := compilePatterns([]string{pattern}); err == nil {
+			t.Errorf("compilePatterns(%q) expected error", pattern)
+		}
+	}
+}
+
+func TestNamePattern_Matches(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{"Path", "PATH", true},
+		{"Path", "PATHEXT", false},
+		{"JAVA_*", "java_home", true},
+		{"*_HOME", "M2_HOME", true},
+		{"*_HOME", "HOMEPATH", false},
+		{"re:^VS\\d+COMNTOOLS$", "VS140COMNTOOLS", true},
+		{"re:^VS\\d+COMNTOOLS$", "vs2022comntools", true},
+		{"re:^VS\\d+COMNTOOLS$", "VSCOMNTOOLS", false},
+		{"re:TEMP", "MYTEMPDIR", true},
+	}
+	for _, tt := range tests {
+		patterns, err := compilePatterns([]string{tt.pattern})
+		if err != nil {
+			t.Fatalf("compilePatterns(%q) error = %v", tt.pattern, err)
+		}
+		if got := patterns[0].matches(tt.name); got != tt.expected {
+			t.Errorf("%q matches %q = %v, want %v", tt.pattern, tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestNameFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		include   []string
+		exclude   []string
+		selected  []string
+		unmatched []string
+		missing   []string
+	}{
+		{
+			name:     "all variables",
+			selected: []string{"JAVA_HOME", "JAVA_OPTS", "OS", "Path"},
+		},
+		{
+			name:      "include patterns",
+			include:   []string{"JAVA_*", "os", "GOPATH"},
+			selected:  []string{"JAVA_HOME", "JAVA_OPTS", "OS"},
+			unmatched: []string{"GOPATH"},
+			missing:   []string{"GOPATH"},
+		},
+		{
+			name:      "exclude overrides include",
+			include:   []string{"JAVA_*"},
+			exclude:   []string{"*_OPTS", "re:^GO"},
+			selected:  []string{"JAVA_HOME"},
+			unmatched: []string{"re:^GO"},
+		},
+		{
+			name:     "exclude only",
+			exclude:  []string{"re:^(os|path)$"},
+			selected: []string{"JAVA_HOME", "JAVA_OPTS"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFilter(tt.include, tt.exclude)
+			if err != nil {
+				t.Fatalf("NewFilter() error = %v", err)
+			}
+			var selected []string
+			for _, name := range []string{"JAVA_HOME", "JAVA_OPTS", "OS", "Path"} {
+				if f.Selects(name) {
+					selected = append(selected, name)
+				}
+			}
+			if !slices.Equal(selected, tt.selected) {
+				t.Errorf("selected %v, want %v", selected, tt.selected)
+			}
+			if got := f.Unmatched(); !slices.Equal(got, tt.unmatched) {
+				t.Errorf("unmatched() = %v, want %v", got, tt.unmatched)
+			}
+			if got := f.Missing(); !slices.Equal(got, tt.missing) {
+				t.Errorf("missing() = %v, want %v", got, tt.missing)
+			}
+		})
+	}
+}
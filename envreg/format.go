@@ -0,0 +1,122 @@
+package envreg
+
+import (
+	"fmt"
+	"io"
+	"slices"
+)
+
+// FormatOptions configure the output formats. Options that do not apply to a
+// format are ignored.
+type FormatOptions struct {
+	Header     bool   // text: print the registry keys and the export time
+	Types      bool   // text: print the registry value types in section headers
+	Provenance bool   // text, json: print the hive of the entries and the shadowed system values
+	PathStyle  string // sh, fish: translation of paths like C:\foo, see pathStyles
+}
+
+// Formatter writes an environment to w in an output format.
+type Formatter func(w io.Writer, env *Environment, opts FormatOptions) error
+
+// formatNames are the names of the output formats, in the order of Formats.
+var formatNames = []string{"text", "json", "reg", "ps1", "sh", "fish", "dotenv"}
+
+// formatters are the writers of the output formats, keyed by name.
+var formatters = map[string]Formatter{
+	"text":   WriteText,
+	"json":   WriteJSON,
+	"reg":    WriteReg,
+	"ps1":    WritePS1,
+	"sh":     WriteSh,
+	"fish":   WriteFish,
+	"dotenv": WriteDotenv,
+}
+
+// Formats returns the names of the output formats, eg. "json".
+func Formats() []string {
+	return slices.Clone(formatNames)
+}
+
+// CheckFormat returns an error if the format or the path style of opts is not
+// supported, so that options can be checked before reading the environment.
+func CheckFormat(format string, opts FormatOptions) error {
+	if _, ok := formatters[format]; !ok {
+		return fmt.Errorf("unknown output format: %s", format)
+	}
+	if _, ok := pathStyles[opts.PathStyle]; !ok && opts.PathStyle != "" {
+		return fmt.Errorf("unknown path style: %s", opts.PathStyle)
+	}
+	return nil
+}
+
+// Write writes the environment to w in the named format.
+//
+// Parameters:
+//   - w: the writer receiving the output
+//   - env: the environment to write
+//   - format: the name of the format, one of Formats
+//   - opts: the options of the format
+//
+// Returns an error if the format or its options are not supported, a value
+// cannot be converted, or writing fails.
+func Write(w io.Writer, env *Environment, format string, opts FormatOptions) error {
+	if err := CheckFormat(format, opts); err != nil {
+		return err
+	}
+	return formatters[format](w, env, opts)
+}
+
+// WriteText writes the variables in the section format read by pokenv, see
+// Environment.String.
+func WriteText(w io.Writer, env *Environment, opts FormatOptions) error {
+	_, err := io.WriteString(w, env.text(opts))
+	return err
+}
+
+// WriteJSON writes the variables as an indented JSON object keyed by variable name.
+func WriteJSON(w io.Writer, env *Environment, opts FormatOptions) error {
+	data, err := env.json(opts)
+	if err != nil {
+		return fmt.Errorf("formatting json: %w", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// WriteReg writes the variables as a Windows .reg file, like regedit.
+func WriteReg(w io.Writer, env *Environment, _ FormatOptions) error {
+	data, err := env.regFile()
+	if err != nil {
+		return fmt.Errorf("formatting reg file: %w", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// WritePS1 writes a PowerShell script setting the variables in the registry.
+func WritePS1(w io.Writer, env *Environment, _ FormatOptions) error {
+	data, err := env.ps1Script()
+	if err != nil {
+		return fmt.Errorf("formatting powershell script: %w", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// WriteSh writes POSIX shell commands exporting the variables.
+func WriteSh(w io.Writer, env *Environment, opts FormatOptions) error {
+	_, err := io.WriteString(w, env.shellScript(false, opts.PathStyle))
+	return err
+}
+
+// WriteFish writes fish shell commands exporting the variables.
+func WriteFish(w io.Writer, env *Environment, opts FormatOptions) error {
+	_, err := io.WriteString(w, env.shellScript(true, opts.PathStyle))
+	return err
+}
+
+// WriteDotenv writes the variables as a .env file.
+func WriteDotenv(w io.Writer, env *Environment, _ FormatOptions) error {
+	_, err := io.WriteString(w, env.dotenv())
+	return err
+}
@@ -0,0 +1,76 @@
+package envreg
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/tischda/peekenv/v3/regf"
+)
+
+// LoadHiveFile reads the environment variables of an offline registry hive file:
+// the Environment key of the current control set of a SYSTEM hive, or the
+// Environment key of an NTUSER.DAT hive.
+//
+// Parameters:
+//   - path: the name of the hive file
+//   - hive: HKLM for a SYSTEM hive, HKCU for an NTUSER.DAT hive
+//
+// Returns a source with the variables, or an error if the file cannot be read or
+// does not contain the Environment key.
+func LoadHiveFile(path string, hive Hive) (*MemSource, error) {
+	h, err := regf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	root, err := h.Root()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	keyPath := userKeyPath
+	if hive == HKLM {
+		if keyPath, err = currentControlSet(root); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	key, err := root.Subkey(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	values, err := key.Values()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	src := NewMemSource(hive)
+	for _, v := range values {
+		if v.Name == "" {
+			continue // default value of the key, not a variable
+		}
+		if v.Type == REG_MULTI_SZ {
+			src.SetStrings(v.Name, multiStrings(v.Data))
+			continue
+		}
+		src.Set(v.Name, valueString(v.Data, v.Type), v.Type)
+	}
+	return src, nil
+}
+
+// currentControlSet returns the path of the system Environment key in a SYSTEM
+// hive, which has no CurrentControlSet link: Select\Current is the number of the
+// control set in use, eg. ControlSet001.
+func currentControlSet(root *regf.Key) (string, error) {
+	sel, err := root.Subkey("Select")
+	if err != nil {
+		return "", fmt.Errorf("not a SYSTEM hive: %w", err)
+	}
+	current, err := sel.Value("Current")
+	if err != nil {
+		return "", fmt.Errorf("not a SYSTEM hive: %w", err)
+	}
+	if current.Type != REG_DWORD || len(current.Data) != 4 {
+		return "", fmt.Errorf("invalid Select\\Current value of type %s", TypeName(current.Type))
+	}
+	n := binary.LittleEndian.Uint32(current.Data)
+	return fmt.Sprintf(`ControlSet%03d\Control\Session Manager\Environment`, n), nil
+}
@@ -0,0 +1,155 @@
+package envreg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tischda/peekenv/v3/regf/regftest"
+)
+
+// writeHive writes a hive file built from root to a temporary directory.
+func writeHive(t *testing.T, name string, root *regftest.Key) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, regftest.Build(root), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// environmentKey returns a control set key with an Environment key holding values.
+func environmentKey(controlSet string, values ...regftest.Value) *regftest.Key {
+	return &regftest.Key{
+		Name: controlSet,
+		Subkeys: []*regftest.Key{{
+			Name: "Control",
+			Subkeys: []*regftest.Key{{
+				Name: "Session Manager",
+				Subkeys: []*regftest.Key{{
+					Name:   "Environment",
+					Values: values,
+				}},
+			}},
+		}},
+	}
+}
+
+// systemHive returns a SYSTEM hive whose current control set is ControlSet002.
+func systemHive() *regftest.Key {
+	return &regftest.Key{
+		Name: "ROOT",
+		Subkeys: []*regftest.Key{
+			environmentKey("ControlSet001",
+				regftest.Value{Name: "OS", Type: REG_SZ, Data: regftest.String("stale")},
+			),
+			environmentKey("ControlSet002",
+				regftest.Value{Name: "OS", Type: REG_SZ, Data: regftest.String("Windows_NT")},
+				regftest.Value{Name: "Path", Type: REG_EXPAND_SZ, Data: regftest.String(`%SystemRoot%\system32`)},
+				regftest.Value{Name: "NUMBER_OF_PROCESSORS", Type: REG_DWORD, Data: regftest.Dword(8)},
+			),
+			{
+				Name:   "Select",
+				Values: []regftest.Value{{Name: "Current", Type: REG_DWORD, Data: regftest.Dword(2)}},
+			},
+		},
+	}
+}
+
+// userHive returns an NTUSER.DAT hive with user variables.
+func userHive() *regftest.Key {
+	return &regftest.Key{
+		Name: "ROOT",
+		Subkeys: []*regftest.Key{
+			{Name: "Console"},
+			{
+				Name: "Environment",
+				Values: []regftest.Value{
+					{Name: "", Type: REG_SZ, Data: regftest.String("default")},
+					{Name: "Path", Type: REG_EXPAND_SZ, Data: regftest.String(`%USERPROFILE%\bin`)},
+					{Name: "TEMP", Type: REG_EXPAND_SZ, Data: regftest.String(`%USERPROFILE%\Temp`)},
+				},
+			},
+		},
+	}
+}
+
+func TestLoadHiveFile_System(t *testing.T) {
+	src, err := LoadHiveFile(writeHive(t, "SYSTEM", systemHive()), HKLM)
+	if err != nil {
+		t.Fatalf("LoadHiveFile() error = %v", err)
+	}
+	expected := map[string]memValue{
+		"OS":                   {data: "Windows_NT", valtype: REG_SZ},
+		"Path":                 {data: `%SystemRoot%\system32`, valtype: REG_EXPAND_SZ},
+		"NUMBER_OF_PROCESSORS": {data: "8", valtype: REG_DWORD},
+	}
+	if !reflect.DeepEqual(src.values, expected) {
+		t.Errorf("LoadHiveFile() = %v, want %v", src.values, expected)
+	}
+}
+
+func TestLoadHiveFile_User(t *testing.T) {
+	src, err := LoadHiveFile(writeHive(t, "NTUSER.DAT", userHive()), HKCU)
+	if err != nil {
+		t.Fatalf("LoadHiveFile() error = %v", err)
+	}
+	expected := map[string]memValue{
+		"Path": {data: `%USERPROFILE%\bin`, valtype: REG_EXPAND_SZ},
+		"TEMP": {data: `%USERPROFILE%\Temp`, valtype: REG_EXPAND_SZ},
+	}
+	if !reflect.DeepEqual(src.values, expected) {
+		t.Errorf("LoadHiveFile() = %v, want %v", src.values, expected)
+	}
+}
+
+func TestLoadHiveFile_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		root *regftest.Key
+		hive Hive
+		err  string
+	}{
+		{"user hive as system", userHive(), HKLM, "not a SYSTEM hive"},
+		{"system hive as user", systemHive(), HKCU, "key Environment: not found"},
+		{
+			name: "missing control set",
+			root: &regftest.Key{Name: "ROOT", Subkeys: []*regftest.Key{{
+				Name:   "Select",
+				Values: []regftest.Value{{Name: "Current", Type: REG_DWORD, Data: regftest.Dword(3)}},
+			}}},
+			hive: HKLM,
+			err:  `ControlSet003\Control\Session Manager\Environment: not found`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadHiveFile(writeHive(t, "hive", tt.root), tt.hive)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("LoadHiveFile() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoadHiveFile_Pipeline(t *testing.T) {
+	system, err := LoadHiveFile(writeHive(t, "SYSTEM", systemHive()), HKLM)
+	if err != nil {
+		t.Fatalf("LoadHiveFile() error = %v", err)
+	}
+	user, err := LoadHiveFile(writeHive(t, "NTUSER.DAT", userHive()), HKCU)
+	if err != nil {
+		t.Fatalf("LoadHiveFile() error = %v", err)
+	}
+	env, err := Read(context.Background(), Options{System: system, User: user})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	expected := `%SystemRoot%\system32;%USERPROFILE%\bin`
+	if got := env.Variables["Path"].Value; got != expected {
+		t.Errorf("Path = %q, want %q", got, expected)
+	}
+}
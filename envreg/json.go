@@ -0,0 +1,52 @@
+package envreg
+
+import (
+	"encoding/json"
+)
+
+// jsonVariable is the JSON representation of an environment variable.
+type jsonVariable struct {
+	Value      string        `json:"value"`
+	Type       string        `json:"type"`
+	Hive       string        `json:"hive"`
+	Entries    []string      `json:"entries,omitempty"`
+	EntryHives []string      `json:"entryHives,omitempty"`
+	Shadowed   *jsonVariable `json:"shadowed,omitempty"`
+}
+
+// json returns the variables as an indented JSON object keyed by variable name.
+// List variables (merged variables and REG_MULTI_SZ values) also contain their
+// entries as an array. If opts.Provenance is set, list variables
+// also contain the hive of each entry, and user variables overriding a system
+// variable contain the shadowed system value.
+func (env *Environment) json(opts FormatOptions) ([]byte, error) {
+	out := make(map[string]jsonVariable, len(env.Variables))
+	for name, v := range env.Variables {
+		jv := jsonVariable{
+			Value: v.Value,
+			Type:  TypeName(v.Type),
+			Hive:  v.Hive.String(),
+		}
+		if env.isList(name, v) {
+			jv.Entries = v.Entries()
+			if opts.Provenance {
+				for _, hive := range v.EntryHives() {
+					jv.EntryHives = append(jv.EntryHives, hive.String())
+				}
+			}
+		}
+		if opts.Provenance && v.Shadowed != nil {
+			jv.Shadowed = &jsonVariable{
+				Value: v.Shadowed.Value,
+				Type:  TypeName(v.Shadowed.Type),
+				Hive:  v.Shadowed.Hive.String(),
+			}
+		}
+		out[name] = jv
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
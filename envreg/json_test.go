@@ -0,0 +1,133 @@
+package envreg
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnvironment_JSON(t *testing.T) {
+	env := &Environment{
+		Variables: map[string]Variable{
+			"Path":    {Value: `C:\Windows;%USERPROFILE%\bin`, Type: REG_EXPAND_SZ, Hive: HKLM | HKCU},
+			"OS":      {Value: "Windows_NT", Type: REG_SZ, Hive: HKLM},
+			"M2_HOME": {Value: `c:\usr\bin\maven`, Type: REG_SZ, Hive: HKCU},
+			"JDBC":    {Value: "jdbc:x;user=sa", Type: REG_SZ, Hive: HKCU},
+		},
+	}
+
+	data, err := env.json(FormatOptions{})
+	if err != nil {
+		t.Fatalf("json() error = %v", err)
+	}
+
+	var got map[string]jsonVariable
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json() produced invalid JSON: %v\n%s", err, data)
+	}
+
+	expected := map[string]jsonVariable{
+		"Path": {
+			Value:   `C:\Windows;%USERPROFILE%\bin`,
+			Type:    "REG_EXPAND_SZ",
+			Hive:    "HKLM+HKCU",
+			Entries: []string{`C:\Windows`, `%USERPROFILE%\bin`},
+		},
+		"OS":      {Value: "Windows_NT", Type: "REG_SZ", Hive: "HKLM"},
+		"M2_HOME": {Value: `c:\usr\bin\maven`, Type: "REG_SZ", Hive: "HKCU"},
+		"JDBC":    {Value: "jdbc:x;user=sa", Type: "REG_SZ", Hive: "HKCU"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("json() = %+v, want %+v", got, expected)
+	}
+}
+
+func TestEnvironment_JSON_SingleEntryPath(t *testing.T) {
+	env := &Environment{
+		Variables: map[string]Variable{
+			"Path": {Value: `C:\Windows`, Type: REG_SZ, Hive: HKLM},
+		},
+	}
+
+	data, err := env.json(FormatOptions{})
+	if err != nil {
+		t.Fatalf("json() error = %v", err)
+	}
+	var got map[string]jsonVariable
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json() produced invalid JSON: %v", err)
+	}
+	if !reflect.DeepEqual(got["Path"].Entries, []string{`C:\Windows`}) {
+		t.Errorf("Path entries = %v, want single entry", got["Path"].Entries)
+	}
+}
+
+func TestEnvironment_JSON_Provenance(t *testing.T) {
+	system, user := fixtureSources()
+	env, err := Read(context.Background(), Options{
+		Variables: []string{"Path", "TEMP"},
+		System:    system,
+		User:      user,
+	})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	data, err := env.json(FormatOptions{Provenance: true})
+	if err != nil {
+		t.Fatalf("json() error = %v", err)
+	}
+	var got map[string]jsonVariable
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json() produced invalid JSON: %v", err)
+	}
+
+	if hives := got["Path"].EntryHives; !reflect.DeepEqual(hives, []string{"HKLM", "HKLM", "HKCU"}) {
+		t.Errorf("Path entryHives = %v, want [HKLM HKLM HKCU]", hives)
+	}
+	expected := &jsonVariable{Value: `%SystemRoot%\TEMP`, Type: "REG_EXPAND_SZ", Hive: "HKLM"}
+	if !reflect.DeepEqual(got["TEMP"].Shadowed, expected) {
+		t.Errorf("TEMP shadowed = %+v, want %+v", got["TEMP"].Shadowed, expected)
+	}
+}
+
+func TestEnvironment_CustomSeparator(t *testing.T) {
+	system := NewMemSource(HKLM)
+	system.Set("CLASSPATH", `C:\lib\a.jar,C:\lib\b.jar`, REG_SZ)
+	user := NewMemSource(HKCU)
+	user.Set("CLASSPATH", `C:\Users\me\c.jar`, REG_SZ)
+	policy, err := NewMergePolicy("CLASSPATH", "system", ",")
+	if err != nil {
+		t.Fatalf("NewMergePolicy() error = %v", err)
+	}
+	env, err := Read(context.Background(), Options{System: system, User: user, Merge: policy})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	data, err := env.json(FormatOptions{Provenance: true})
+	if err != nil {
+		t.Fatalf("json() error = %v", err)
+	}
+	var got map[string]jsonVariable
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json() produced invalid JSON: %v", err)
+	}
+	expected := jsonVariable{
+		Value:      `C:\lib\a.jar,C:\lib\b.jar,C:\Users\me\c.jar`,
+		Type:       "REG_SZ",
+		Hive:       "HKLM+HKCU",
+		Entries:    []string{`C:\lib\a.jar`, `C:\lib\b.jar`, `C:\Users\me\c.jar`},
+		EntryHives: []string{"HKLM", "HKLM", "HKCU"},
+	}
+	if !reflect.DeepEqual(got["CLASSPATH"], expected) {
+		t.Errorf("CLASSPATH = %+v, want %+v", got["CLASSPATH"], expected)
+	}
+
+	text := env.text(FormatOptions{})
+	if want := "[CLASSPATH]\nC:\\lib\\a.jar\nC:\\lib\\b.jar\nC:\\Users\\me\\c.jar\n"; !strings.Contains(text, want) {
+		t.Errorf("text() = %q, want entries on separate lines", text)
+	}
+}
@@ -0,0 +1,38 @@
+package envreg
+
+import "strings"
+
+// SplitList returns the entries of a list value, like Path, separated by
+// semicolons. Like Windows, semicolons between double quotes do not separate
+// entries, eg. "C:\a;b";C:\c has two entries. An unterminated quote extends to
+// the end of the value. The quotes are kept in the entries, so that joining
+// the entries with semicolons returns the value.
+func SplitList(value string) []string {
+	return splitList(value, ";")
+}
+
+// splitList returns the entries of a list value separated by sep, like SplitList.
+func splitList(value, sep string) []string {
+	if sep == "" {
+		sep = ";"
+	}
+	var entries []string
+	start, quoted := 0, false
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '"':
+			quoted = !quoted
+		case !quoted && strings.HasPrefix(value[i:], sep):
+			entries = append(entries, value[start:i])
+			start = i + len(sep)
+			i += len(sep) - 1
+		}
+	}
+	return append(entries, value[start:])
+}
+
+// UnquoteEntry returns a list entry without its double quotes, eg. the
+// directory searched by Windows for the Path entry "C:\a;b".
+func UnquoteEntry(entry string) string {
+	return strings.ReplaceAll(entry, `"`, "")
+}
@@ -0,0 +1,53 @@
+package envreg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected []string
+	}{
+		{name: "empty", value: "", expected: []string{""}},
+		{name: "entries", value: `C:\a;C:\b`, expected: []string{`C:\a`, `C:\b`}},
+		{name: "empty entries", value: `;C:\a;;`, expected: []string{"", `C:\a`, "", ""}},
+		{name: "quoted semicolon", value: `C:\a;"C:\b;c";C:\d`, expected: []string{`C:\a`, `"C:\b;c"`, `C:\d`}},
+		{name: "quotes inside entry", value: `C:\"x;y"\z;C:\d`, expected: []string{`C:\"x;y"\z`, `C:\d`}},
+		{name: "quoted without semicolon", value: `"C:\Program Files";C:\d`, expected: []string{`"C:\Program Files"`, `C:\d`}},
+		{name: "unterminated quote", value: `C:\a;"C:\b;C:\c`, expected: []string{`C:\a`, `"C:\b;C:\c`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SplitList(tt.value)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("SplitList(%q) = %q, want %q", tt.value, got, tt.expected)
+			}
+			if joined := strings.Join(got, ";"); joined != tt.value {
+				t.Errorf("SplitList(%q) joined = %q, want value", tt.value, joined)
+			}
+		})
+	}
+}
+
+func TestUnquoteEntry(t *testing.T) {
+	if got := UnquoteEntry(`"C:\b;c"`); got != `C:\b;c` {
+		t.Errorf("UnquoteEntry() = %q, want %q", got, `C:\b;c`)
+	}
+}
+
+func TestMergePolicy_Split(t *testing.T) {
+	policy, err := NewMergePolicy("CLASSPATH", "system", " | ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := policy.Split("classpath", `a | "b | c" | d`); !reflect.DeepEqual(got, []string{"a", `"b | c"`, "d"}) {
+		t.Errorf("Split(CLASSPATH) = %q", got)
+	}
+	if got := policy.Split("Path", `a;b | c`); !reflect.DeepEqual(got, []string{"a", "b | c"}) {
+		t.Errorf("Split(Path) = %q", got)
+	}
+}
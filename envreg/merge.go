@@ -0,0 +1,106 @@
+package envreg
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// PathVariables are the variables whose user value is appended to the system value by default.
+var PathVariables = []string{"Path", "PsModulePath"}
+
+// MergePolicy decides how a variable defined in both hives is combined. Variables
+// matching the policy are concatenated, all other user variables override the
+// system variable with the same name.
+//
+// The zero value merges PathVariables, system value first, separated by a semicolon.
+type MergePolicy struct {
+	patterns  []string // names or glob patterns (eg. *_PATH), '!' excludes a match; nil for PathVariables
+	separator string   // separator between system and user values, semicolon if empty
+	userFirst bool     // put the user value before the system value
+}
+
+// NewMergePolicy returns a merge policy, eg. defined by command line options.
+//
+// Parameters:
+//   - list: comma separated names or glob patterns of the variables to merge, eg. "Path,*_PATH,!JAVA_PATH"
+//   - order: "system" to put system values first, "user" to put user values first
+//   - separator: the separator inserted between system and user values
+//
+// Returns an error if a pattern or the order is invalid.
+func NewMergePolicy(list, order, separator string) (MergePolicy, error) {
+	policy := MergePolicy{
+		patterns:  []string{},
+		separator: separator,
+	}
+	for _, pattern := range strings.Split(list, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(strings.TrimPrefix(pattern, "!"), ""); err != nil {
+			return policy, fmt.Errorf("invalid merge pattern %q: %w", pattern, err)
+		}
+		policy.patterns = append(policy.patterns, pattern)
+	}
+
+	switch order {
+	case "system":
+	case "user":
+		policy.userFirst = true
+	default:
+		return policy, fmt.Errorf("invalid merge order %q, expected system or user", order)
+	}
+	return policy, nil
+}
+
+// Merges reports whether the user and system values of the named variable are
+// concatenated. Names are matched case-insensitively, the last matching pattern wins.
+func (m MergePolicy) Merges(name string) bool {
+	patterns := m.patterns
+	if patterns == nil {
+		patterns = PathVariables
+	}
+	merged := false
+	for _, pattern := range patterns {
+		exclude := strings.HasPrefix(pattern, "!")
+		if matchName(strings.TrimPrefix(pattern, "!"), name) {
+			merged = !exclude
+		}
+	}
+	return merged
+}
+
+// Separator returns the separator between the entries of merged variables,
+// inserted between the system and user values.
+func (m MergePolicy) Separator() string {
+	if m.separator == "" {
+		return ";"
+	}
+	return m.separator
+}
+
+// Split returns the entries of a value of the named variable: separated by the
+// separator of the policy if the variable is merged, by semicolons otherwise.
+func (m MergePolicy) Split(name, value string) []string {
+	if m.Merges(name) {
+		return splitList(value, m.Separator())
+	}
+	return SplitList(value)
+}
+
+// join concatenates the system and user values in the order of the policy.
+func (m MergePolicy) join(system, user Part) (string, []Part) {
+	sep := m.Separator()
+	if m.userFirst {
+		return user.Value + sep + system.Value, []Part{user, system}
+	}
+	return system.Value + sep + user.Value, []Part{system, user}
+}
+
+// matchName reports whether a variable name matches a name or glob pattern,
+// ignoring case.
+func matchName(pattern, name string) bool {
+	matched, err := path.Match(strings.ToUpper(pattern), strings.ToUpper(name))
+	return err == nil && matched
+}
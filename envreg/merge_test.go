@@ -0,0 +1,87 @@
+package envreg
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMergePolicy_Merges(t *testing.T) {
+	tests := []struct {
+		name     string
+		list     string
+		variable string
+		expected bool
+	}{
+		{name: "default Path", variable: "Path", expected: true},
+		{name: "default is case-insensitive", variable: "PSMODULEPATH", expected: true},
+		{name: "default does not merge PATHEXT", variable: "PATHEXT", expected: false},
+		{name: "explicit names", list: "PATHEXT, CLASSPATH", variable: "classpath", expected: true},
+		{name: "explicit list replaces default", list: "PATHEXT", variable: "Path", expected: false},
+		{name: "glob pattern", list: "*_PATH", variable: "my_path", expected: true},
+		{name: "glob does not match", list: "*_PATH", variable: "PYTHONPATH", expected: false},
+		{name: "excluded by later pattern", list: "*_PATH,!JAVA_PATH", variable: "java_path", expected: false},
+		{name: "empty list merges nothing", list: " ", variable: "Path", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := MergePolicy{}
+			if tt.list != "" {
+				var err error
+				policy, err = NewMergePolicy(tt.list, "system", ";")
+				if err != nil {
+					t.Fatalf("NewMergePolicy() error = %v", err)
+				}
+			}
+			if got := policy.Merges(tt.variable); got != tt.expected {
+				t.Errorf("Merges(%q) = %v, want %v", tt.variable, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewMergePolicy_Errors(t *testing.T) {
+	if _, err := NewMergePolicy("Path,[", "system", ";"); err == nil {
+		t.Error("NewMergePolicy() should fail for invalid pattern")
+	}
+	if _, err := NewMergePolicy("Path", "first", ";"); err == nil {
+		t.Error("NewMergePolicy() should fail for invalid order")
+	}
+}
+
+func TestRead_MergePolicy(t *testing.T) {
+	system, user := fixtureSources()
+	system.Set("PATHEXT", ".COM;.EXE", REG_SZ)
+	user.Set("pathext", ".PY", REG_SZ)
+	system.Set("CLASSPATH", `C:\lib\a.jar`, REG_SZ)
+	user.Set("CLASSPATH", `C:\lib\b.jar`, REG_SZ)
+
+	policy, err := NewMergePolicy("path,PATHEXT,CLASSPATH", "user", ":")
+	if err != nil {
+		t.Fatalf("NewMergePolicy() error = %v", err)
+	}
+	env, err := Read(context.Background(), Options{
+		System: system,
+		User:   user,
+		Merge:  policy,
+	})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	expected := map[string]string{
+		"Path":         `%USERPROFILE%\AppData\Local\Microsoft\WindowsApps:%SystemRoot%\system32;%SystemRoot%`,
+		"PATHEXT":      ".PY:.COM;.EXE",
+		"CLASSPATH":    `C:\lib\b.jar:C:\lib\a.jar`,
+		"TEMP":         `%USERPROFILE%\AppData\Local\Temp`,
+		"PsModulePath": `%ProgramFiles%\WindowsPowerShell\Modules`,
+	}
+	for k, v := range expected {
+		if got := env.Variables[k].Value; got != v {
+			t.Errorf("Variables[%s] = %q, want %q", k, got, v)
+		}
+	}
+	if parts := env.Variables["Path"].Parts; len(parts) != 2 || parts[0].Hive != HKCU {
+		t.Errorf("Path parts = %+v, want user part first", parts)
+	}
+}
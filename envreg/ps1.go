@@ -0,0 +1,147 @@
+package envreg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// psScopes are the targets of [Environment]::SetEnvironmentVariable for each hive.
+var psScopes = map[Hive]string{
+	HKLM: "Machine",
+	HKCU: "User",
+}
+
+// psValueKinds are the RegistryValueKind names of the types that are not REG_SZ.
+var psValueKinds = map[uint32]string{
+	REG_EXPAND_SZ: "ExpandString",
+	REG_MULTI_SZ:  "MultiString",
+	REG_DWORD:     "DWord",
+	REG_QWORD:     "QWord",
+	REG_BINARY:    "Binary",
+}
+
+// ps1Script returns a PowerShell script recreating the variables in the hive they
+// were read from. REG_SZ values are set with [Environment]::SetEnvironmentVariable,
+// other types are written to the registry with their value kind, so that
+// REG_EXPAND_SZ values keep their %VAR% references. The script is encoded in UTF-8
+// with byte order mark, which Windows PowerShell 5.1 needs to read non-ASCII text.
+// Only the hives of env.Mode are written.
+//
+// Returns an error if a value cannot be converted to its registry type.
+func (env *Environment) ps1Script() ([]byte, error) {
+	lines := make(map[Hive][]string)
+	registryWrites := false
+	for _, name := range env.Names() {
+		for _, pt := range env.Variables[name].HiveValues() {
+			line, err := psStatement(name, pt)
+			if err != nil {
+				return nil, fmt.Errorf("%s\\%s: %w", pt.Hive, name, err)
+			}
+			lines[pt.Hive] = append(lines[pt.Hive], line)
+			registryWrites = registryWrites || pt.Type != REG_SZ
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\ufeff# Environment variables exported by peekenv\r\n")
+	if len(lines[HKLM]) > 0 {
+		sb.WriteString("#Requires -RunAsAdministrator\r\n")
+	}
+	sb.WriteString("$ErrorActionPreference = 'Stop'\r\n")
+	sb.WriteString("$machine = " + psQuote(regRootKeys[HKLM]) + "\r\n")
+	sb.WriteString("$user = " + psQuote(regRootKeys[HKCU]) + "\r\n")
+
+	for _, hive := range []Hive{HKLM, HKCU} {
+		if (hive == HKLM && env.Mode == User) || (hive == HKCU && env.Mode == Machine) || len(lines[hive]) == 0 {
+			continue
+		}
+		sb.WriteString("\r\n# " + strings.ToLower(psScopes[hive]) + " variables\r\n")
+		for _, line := range lines[hive] {
+			sb.WriteString(line + "\r\n")
+		}
+	}
+
+	if registryWrites {
+		// SetEnvironmentVariable notifies running applications (WM_SETTINGCHANGE),
+		// writing to the registry directly does not
+		sb.WriteString("\r\n# notify running applications that the environment changed\r\n")
+		sb.WriteString("[Environment]::SetEnvironmentVariable('PEEKENV_NOTIFY', '1', 'User')\r\n")
+		sb.WriteString("[Environment]::SetEnvironmentVariable('PEEKENV_NOTIFY', $null, 'User')\r\n")
+	}
+	return []byte(sb.String()), nil
+}
+
+// psStatement returns the PowerShell statement setting a variable in a hive.
+//
+// Parameters:
+//   - name: the variable name
+//   - pt: the value, type and hive of the variable
+func psStatement(name string, pt Part) (string, error) {
+	if pt.Type == REG_SZ {
+		return fmt.Sprintf("[Environment]::SetEnvironmentVariable(%s, %s, '%s')",
+			psQuote(name), psQuote(pt.Value), psScopes[pt.Hive]), nil
+	}
+
+	key := "$machine"
+	if pt.Hive == HKCU {
+		key = "$user"
+	}
+	kind, ok := psValueKinds[pt.Type]
+	if !ok {
+		return "", fmt.Errorf("%s values are not supported", TypeName(pt.Type))
+	}
+
+	var value string
+	switch pt.Type {
+	case REG_EXPAND_SZ:
+		value = psQuote(pt.Value)
+	case REG_MULTI_SZ:
+		var entries []string
+		for _, entry := range pt.multiStrings() {
+			entries = append(entries, psQuote(entry))
+		}
+		value = "[string[]]@(" + strings.Join(entries, ", ") + ")"
+	case REG_DWORD:
+		n, err := strconv.ParseUint(pt.Value, 10, 32)
+		if err != nil {
+			return "", fmt.Errorf("invalid REG_DWORD value: %w", err)
+		}
+		value = fmt.Sprintf("[int]0x%08x", n)
+	case REG_QWORD:
+		n, err := strconv.ParseUint(pt.Value, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid REG_QWORD value: %w", err)
+		}
+		value = fmt.Sprintf("[long]0x%016x", n)
+	case REG_BINARY:
+		if len(pt.Value)%2 != 0 {
+			return "", fmt.Errorf("invalid REG_BINARY value %q", pt.Value)
+		}
+		var digits []string
+		for i := 0; i < len(pt.Value); i += 2 {
+			if _, err := strconv.ParseUint(pt.Value[i:i+2], 16, 8); err != nil {
+				return "", fmt.Errorf("invalid REG_BINARY value: %w", err)
+			}
+			digits = append(digits, "0x"+pt.Value[i:i+2])
+		}
+		value = "[byte[]]@(" + strings.Join(digits, ",") + ")"
+	}
+	return fmt.Sprintf("[Microsoft.Win32.Registry]::SetValue(%s, %s, %s, '%s')", key, psQuote(name), value, kind), nil
+}
+
+// psQuote returns s as a single-quoted PowerShell string. PowerShell also treats
+// the typographic single quotes as quotes, so they are doubled like the ASCII quote.
+func psQuote(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('\'')
+	for _, c := range s {
+		switch c {
+		case '\'', '\u2018', '\u2019', '\u201a', '\u201b':
+			sb.WriteRune(c)
+		}
+		sb.WriteRune(c)
+	}
+	sb.WriteByte('\'')
+	return sb.String()
+}
@@ -0,0 +1,127 @@
+package envreg
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestEnvironment_Ps1Script(t *testing.T) {
+	system, user := fixtureSources()
+	env, err := Read(context.Background(), Options{
+		System: system,
+		User:   user,
+	})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	data, err := env.ps1Script()
+	if err != nil {
+		t.Fatalf("ps1Script() error = %v", err)
+	}
+	expected := strings.Join([]string{
+		"\ufeff# Environment variables exported by peekenv",
+		"#Requires -RunAsAdministrator",
+		"$ErrorActionPreference = 'Stop'",
+		`$machine = 'HKEY_LOCAL_MACHINE\SYSTEM\CurrentControlSet\Control\Session Manager\Environment'`,
+		`$user = 'HKEY_CURRENT_USER\Environment'`,
+		"",
+		"# machine variables",
+		"[Environment]::SetEnvironmentVariable('OS', 'Windows_NT', 'Machine')",
+		`[Microsoft.Win32.Registry]::SetValue($machine, 'Path', '%SystemRoot%\system32;%SystemRoot%', 'ExpandString')`,
+		`[Microsoft.Win32.Registry]::SetValue($machine, 'PsModulePath', '%ProgramFiles%\WindowsPowerShell\Modules', 'ExpandString')`,
+		`[Microsoft.Win32.Registry]::SetValue($machine, 'TEMP', '%SystemRoot%\TEMP', 'ExpandString')`,
+		"",
+		"# user variables",
+		`[Environment]::SetEnvironmentVariable('M2_HOME', 'c:\usr\bin\maven', 'User')`,
+		`[Microsoft.Win32.Registry]::SetValue($user, 'Path', '%USERPROFILE%\AppData\Local\Microsoft\WindowsApps', 'ExpandString')`,
+		`[Microsoft.Win32.Registry]::SetValue($user, 'TEMP', '%USERPROFILE%\AppData\Local\Temp', 'ExpandString')`,
+		"",
+		"# notify running applications that the environment changed",
+		"[Environment]::SetEnvironmentVariable('PEEKENV_NOTIFY', '1', 'User')",
+		"[Environment]::SetEnvironmentVariable('PEEKENV_NOTIFY', $null, 'User')",
+		"",
+	}, "\r\n")
+	if got := string(data); got != expected {
+		t.Errorf("ps1Script() =\n%s\nwant\n%s", got, expected)
+	}
+}
+
+func TestEnvironment_Ps1Script_User(t *testing.T) {
+	env := &Environment{
+		Mode: User,
+		Variables: map[string]Variable{
+			"M2_HOME": {Value: `c:\maven`, Type: REG_SZ, Hive: HKCU},
+		},
+	}
+	data, err := env.ps1Script()
+	if err != nil {
+		t.Fatalf("ps1Script() error = %v", err)
+	}
+	got := string(data)
+	if strings.Contains(got, "#Requires") {
+		t.Errorf("ps1Script(User) requires administrator:\n%s", got)
+	}
+	if strings.Contains(got, "PEEKENV_NOTIFY") {
+		t.Errorf("ps1Script(User) notifies although SetEnvironmentVariable already does:\n%s", got)
+	}
+	if !strings.Contains(got, "[Environment]::SetEnvironmentVariable('M2_HOME', 'c:\\maven', 'User')\r\n") {
+		t.Errorf("ps1Script(User) missing user variable:\n%s", got)
+	}
+}
+
+func TestPsStatement(t *testing.T) {
+	tests := []struct {
+		name     string
+		pt       Part
+		expected string
+	}{
+		{"string", Part{Hive: HKCU, Value: "a", Type: REG_SZ}, "[Environment]::SetEnvironmentVariable('X', 'a', 'User')"},
+		{"multi", Part{Hive: HKLM, Value: "a;b", Type: REG_MULTI_SZ}, "[Microsoft.Win32.Registry]::SetValue($machine, 'X', [string[]]@('a', 'b'), 'MultiString')"},
+		{"multi quoted", Part{Hive: HKLM, Value: `"a;b";c`, Type: REG_MULTI_SZ}, "[Microsoft.Win32.Registry]::SetValue($machine, 'X', [string[]]@('\"a', 'b\"', 'c'), 'MultiString')"},
+		{"multi entries", Part{Hive: HKLM, Value: "a;b;c", Type: REG_MULTI_SZ, multi: []string{"a;b", "c"}}, "[Microsoft.Win32.Registry]::SetValue($machine, 'X', [string[]]@('a;b', 'c'), 'MultiString')"},
+		{"dword", Part{Hive: HKLM, Value: "4294967295", Type: REG_DWORD}, "[Microsoft.Win32.Registry]::SetValue($machine, 'X', [int]0xffffffff, 'DWord')"},
+		{"qword", Part{Hive: HKCU, Value: "1", Type: REG_QWORD}, "[Microsoft.Win32.Registry]::SetValue($user, 'X', [long]0x0000000000000001, 'QWord')"},
+		{"binary", Part{Hive: HKCU, Value: "0aff", Type: REG_BINARY}, "[Microsoft.Win32.Registry]::SetValue($user, 'X', [byte[]]@(0x0a,0xff), 'Binary')"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := psStatement("X", tt.pt)
+			if err != nil {
+				t.Fatalf("psStatement() error = %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("psStatement() = %s, want %s", got, tt.expected)
+			}
+		})
+	}
+
+	for _, pt := range []Part{
+		{Hive: HKCU, Value: "x", Type: REG_DWORD},
+		{Hive: HKCU, Value: "0g", Type: REG_BINARY},
+		{Hive: HKCU, Value: "", Type: REG_NONE},
+	} {
+		if _, err := psStatement("X", pt); err == nil {
+			t.Errorf("psStatement(%s %q) expected error", TypeName(pt.Type), pt.Value)
+		}
+	}
+}
+
+func TestPsQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"plain", "'plain'"},
+		{"", "''"},
+		{"it's", "'it''s'"},
+		{"$env:PATH `n", "'$env:PATH `n'"},
+		{"curly \u2018quotes\u2019", "'curly \u2018\u2018quotes\u2019\u2019'"},
+	}
+	for _, tt := range tests {
+		if got := psQuote(tt.input); got != tt.expected {
+			t.Errorf("psQuote(%q) = %s, want %s", tt.input, got, tt.expected)
+		}
+	}
+}
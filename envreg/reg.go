@@ -0,0 +1,150 @@
+package envreg
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Root key names used in .reg files.
+var regRootKeys = map[Hive]string{
+	HKLM: `HKEY_LOCAL_MACHINE\` + systemKeyPath,
+	HKCU: `HKEY_CURRENT_USER\` + userKeyPath,
+}
+
+// regLineLength is the length after which hexadecimal values are continued on the
+// next line, like in the files exported by regedit.
+const regLineLength = 77
+
+// regFile returns the variables as a Windows Registry Editor 5.00 file, encoded in
+// UTF-16LE with byte order mark, like the files exported by regedit. Variables are
+// written to the key of the hive they were read from, merged variables and shadowed
+// system variables are split into the value of each hive. Only the keys of
+// env.Mode are written.
+//
+// Returns an error if a value cannot be converted to its registry type.
+func (env *Environment) regFile() ([]byte, error) {
+	values := make(map[Hive][]string)
+	for _, name := range env.Names() {
+		for _, pt := range env.Variables[name].HiveValues() {
+			line, err := regValue(name, pt)
+			if err != nil {
+				return nil, fmt.Errorf("%s\\%s: %w", pt.Hive, name, err)
+			}
+			values[pt.Hive] = append(values[pt.Hive], line)
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Windows Registry Editor Version 5.00\r\n")
+	for _, hive := range []Hive{HKLM, HKCU} {
+		if (hive == HKLM && env.Mode == User) || (hive == HKCU && env.Mode == Machine) {
+			continue
+		}
+		sb.WriteString("\r\n[" + regRootKeys[hive] + "]\r\n")
+		for _, line := range values[hive] {
+			sb.WriteString(line + "\r\n")
+		}
+	}
+	sb.WriteString("\r\n")
+	return encodeUTF16(sb.String()), nil
+}
+
+// regValue returns the line defining a value in a .reg file, eg. "TEMP"="C:\\Temp".
+// Strings are quoted, except REG_EXPAND_SZ which is written as hex(2), and strings
+// containing line breaks which cannot be quoted.
+//
+// Parameters:
+//   - name: the value name
+//   - pt: the value, as returned by Source.Value, and its registry type
+func regValue(name string, pt Part) (string, error) {
+	prefix := regQuote(name) + "="
+	value, valtype := pt.Value, pt.Type
+	switch valtype {
+	case REG_SZ:
+		if !strings.ContainsAny(value, "\r\n") {
+			return prefix + regQuote(value), nil
+		}
+		return regHex(prefix+"hex(1):", utf16Bytes(value)), nil
+	case REG_EXPAND_SZ:
+		return regHex(prefix+"hex(2):", utf16Bytes(value)), nil
+	case REG_MULTI_SZ:
+		var data []byte
+		for _, entry := range pt.multiStrings() {
+			data = append(data, utf16Bytes(entry)...)
+		}
+		return regHex(prefix+"hex(7):", append(data, 0, 0)), nil
+	case REG_DWORD:
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return "", fmt.Errorf("invalid REG_DWORD value: %w", err)
+		}
+		return fmt.Sprintf("%sdword:%08x", prefix, n), nil
+	case REG_QWORD:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid REG_QWORD value: %w", err)
+		}
+		return regHex(prefix+"hex(b):", binary.LittleEndian.AppendUint64(nil, n)), nil
+	case REG_BINARY:
+		data, err := hex.DecodeString(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid REG_BINARY value: %w", err)
+		}
+		return regHex(prefix+"hex:", data), nil
+	default:
+		data, err := hex.DecodeString(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s value: %w", TypeName(valtype), err)
+		}
+		return regHex(fmt.Sprintf("%shex(%x):", prefix, valtype), data), nil
+	}
+}
+
+// regQuote returns s in double quotes, with backslashes and quotes escaped.
+func regQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// regHex returns the bytes as comma separated hexadecimal numbers following prefix,
+// continued on the next line with a backslash when the line gets too long.
+func regHex(prefix string, data []byte) string {
+	var sb strings.Builder
+	sb.WriteString(prefix)
+	lineLen := len(prefix)
+	for i, b := range data {
+		sb.WriteString(fmt.Sprintf("%02x", b))
+		lineLen += 2
+		if i == len(data)-1 {
+			break
+		}
+		sb.WriteString(",")
+		lineLen++
+		if lineLen >= regLineLength {
+			sb.WriteString("\\\r\n  ")
+			lineLen = 2
+		}
+	}
+	return sb.String()
+}
+
+// utf16Bytes returns s as null-terminated UTF-16LE bytes, as stored in the registry.
+func utf16Bytes(s string) []byte {
+	var data []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		data = binary.LittleEndian.AppendUint16(data, c)
+	}
+	return append(data, 0, 0)
+}
+
+// encodeUTF16 returns s encoded in UTF-16LE with byte order mark.
+func encodeUTF16(s string) []byte {
+	data := []byte{0xff, 0xfe}
+	for _, c := range utf16.Encode([]rune(s)) {
+		data = binary.LittleEndian.AppendUint16(data, c)
+	}
+	return data
+}
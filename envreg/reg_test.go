@@ -0,0 +1,126 @@
+package envreg
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+// regText checks the byte order mark of a .reg file and returns its text.
+func regText(t *testing.T, data []byte) string {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte{0xff, 0xfe}) {
+		t.Fatalf("missing UTF-16LE byte order mark: % x", data[:min(len(data), 2)])
+	}
+	return decodeText(data)
+}
+
+func TestEnvironment_RegFile(t *testing.T) {
+	system, user := fixtureSources()
+	env, err := Read(context.Background(), Options{
+		System: system,
+		User:   user,
+	})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	data, err := env.regFile()
+	if err != nil {
+		t.Fatalf("regFile() error = %v", err)
+	}
+	got := regText(t, data)
+
+	expected := strings.Join([]string{
+		"Windows Registry Editor Version 5.00",
+		"",
+		`[HKEY_LOCAL_MACHINE\SYSTEM\CurrentControlSet\Control\Session Manager\Environment]`,
+		`"OS"="Windows_NT"`,
+		`"Path"=hex(2):25,00,53,00,79,00,73,00,74,00,65,00,6d,00,52,00,6f,00,6f,00,74,\`,
+		`  00,25,00,5c,00,73,00,79,00,73,00,74,00,65,00,6d,00,33,00,32,00,3b,00,25,00,\`,
+		`  53,00,79,00,73,00,74,00,65,00,6d,00,52,00,6f,00,6f,00,74,00,25,00,00,00`,
+		`"PsModulePath"=hex(2):25,00,50,00,72,00,6f,00,67,00,72,00,61,00,6d,00,46,00,69,\`,
+		`  00,6c,00,65,00,73,00,25,00,5c,00,57,00,69,00,6e,00,64,00,6f,00,77,00,73,00,\`,
+		`  50,00,6f,00,77,00,65,00,72,00,53,00,68,00,65,00,6c,00,6c,00,5c,00,4d,00,6f,\`,
+		`  00,64,00,75,00,6c,00,65,00,73,00,00,00`,
+		`"TEMP"=hex(2):25,00,53,00,79,00,73,00,74,00,65,00,6d,00,52,00,6f,00,6f,00,74,\`,
+		`  00,25,00,5c,00,54,00,45,00,4d,00,50,00,00,00`,
+		"",
+		`[HKEY_CURRENT_USER\Environment]`,
+		`"M2_HOME"="c:\\usr\\bin\\maven"`,
+		`"Path"=hex(2):25,00,55,00,53,00,45,00,52,00,50,00,52,00,4f,00,46,00,49,00,4c,\`,
+		`  00,45,00,25,00,5c,00,41,00,70,00,70,00,44,00,61,00,74,00,61,00,5c,00,4c,00,\`,
+		`  6f,00,63,00,61,00,6c,00,5c,00,4d,00,69,00,63,00,72,00,6f,00,73,00,6f,00,66,\`,
+		`  00,74,00,5c,00,57,00,69,00,6e,00,64,00,6f,00,77,00,73,00,41,00,70,00,70,00,\`,
+		`  73,00,00,00`,
+		`"TEMP"=hex(2):25,00,55,00,53,00,45,00,52,00,50,00,52,00,4f,00,46,00,49,00,4c,\`,
+		`  00,45,00,25,00,5c,00,41,00,70,00,70,00,44,00,61,00,74,00,61,00,5c,00,4c,00,\`,
+		`  6f,00,63,00,61,00,6c,00,5c,00,54,00,65,00,6d,00,70,00,00,00`,
+		"",
+		"",
+	}, "\r\n")
+	if got != expected {
+		t.Errorf("regFile() =\n%s\nwant\n%s", got, expected)
+	}
+}
+
+func TestEnvironment_RegFile_Mode(t *testing.T) {
+	env := &Environment{
+		Mode: User,
+		Variables: map[string]Variable{
+			"OS":      {Value: "Windows_NT", Type: REG_SZ, Hive: HKLM},
+			"M2_HOME": {Value: `c:\maven`, Type: REG_SZ, Hive: HKCU},
+		},
+	}
+	data, err := env.regFile()
+	if err != nil {
+		t.Fatalf("regFile() error = %v", err)
+	}
+	got := regText(t, data)
+	if strings.Contains(got, "HKEY_LOCAL_MACHINE") || strings.Contains(got, `"OS"`) {
+		t.Errorf("regFile(User) contains system key:\n%s", got)
+	}
+	if !strings.Contains(got, "[HKEY_CURRENT_USER\\Environment]\r\n\"M2_HOME\"=\"c:\\\\maven\"\r\n") {
+		t.Errorf("regFile(User) missing user value:\n%s", got)
+	}
+}
+
+func TestRegValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		valtype  uint32
+		expected string
+	}{
+		{"quotes and backslashes", `say "hi" \o/`, REG_SZ, `"X"="say \"hi\" \\o/"`},
+		{"empty string", "", REG_SZ, `"X"=""`},
+		{"line break", "a\nb", REG_SZ, `"X"=hex(1):61,00,0a,00,62,00,00,00`},
+		{"expand", "%A%", REG_EXPAND_SZ, `"X"=hex(2):25,00,41,00,25,00,00,00`},
+		{"multi", "a;b", REG_MULTI_SZ, `"X"=hex(7):61,00,00,00,62,00,00,00,00,00`},
+		{"dword", "255", REG_DWORD, `"X"=dword:000000ff`},
+		{"qword", "1", REG_QWORD, `"X"=hex(b):01,00,00,00,00,00,00,00`},
+		{"binary", "0aff", REG_BINARY, `"X"=hex:0a,ff`},
+		{"none", "", REG_NONE, `"X"=hex(0):`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := regValue("X", Part{Value: tt.value, Type: tt.valtype})
+			if err != nil {
+				t.Fatalf("regValue() error = %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("regValue() = %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRegValue_Invalid(t *testing.T) {
+	if _, err := regValue("X", Part{Value: "not a number", Type: REG_DWORD}); err == nil {
+		t.Error("regValue() expected error for invalid REG_DWORD")
+	}
+	if _, err := regValue("X", Part{Value: "zz", Type: REG_BINARY}); err == nil {
+		t.Error("regValue() expected error for invalid REG_BINARY")
+	}
+}
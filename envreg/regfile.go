@@ -0,0 +1,262 @@
+package envreg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Headers of the .reg file formats: version 5 files are UTF-16LE, REGEDIT4 files are ANSI.
+const (
+	regHeader  = "Windows Registry Editor Version 5.00"
+	reg4Header = "REGEDIT4"
+)
+
+// regEnvironmentKeys match the keys of .reg files containing environment variables.
+// Exports of offline hives use numbered control sets, exports of other users HKEY_USERS.
+var regEnvironmentKeys = map[Hive]*regexp.Regexp{
+	HKLM: regexp.MustCompile(`(?i)^(HKEY_LOCAL_MACHINE|HKLM)\\SYSTEM\\(CurrentControlSet|ControlSet\d{3})\\Control\\Session Manager\\Environment$`),
+	HKCU: regexp.MustCompile(`(?i)^((HKEY_CURRENT_USER|HKCU)|(HKEY_USERS|HKU)\\[^\\]+)\\Environment$`),
+}
+
+// regEnvironmentAncestors match the Environment keys and the keys containing them,
+// whose deletion with [-KEY] also deletes the environment variables.
+var regEnvironmentAncestors = map[Hive]*regexp.Regexp{
+	HKLM: regexp.MustCompile(`(?i)^(HKEY_LOCAL_MACHINE|HKLM)(\\SYSTEM(\\(CurrentControlSet|ControlSet\d{3})(\\Control(\\Session Manager(\\Environment)?)?)?)?)?$`),
+	HKCU: regexp.MustCompile(`(?i)^((HKEY_CURRENT_USER|HKCU)|(HKEY_USERS|HKU)(\\[^\\]+)?)(\\Environment)?$`),
+}
+
+// LoadRegFile reads the environment variables of a .reg file into the system and
+// user sources. Values are added to the variables already in the sources, so that
+// several files can be loaded one after the other, like with "reg import". Keys
+// other than the Environment keys are ignored, except deleted keys containing
+// them, eg. [-HKEY_CURRENT_USER], which delete their variables.
+//
+// Parameters:
+//   - path: the name of the .reg file, in UTF-16LE or UTF-8
+//   - system: the source receiving the system variables
+//   - user: the source receiving the user variables
+//
+// Returns an error if the file cannot be read or is not a valid .reg file.
+func LoadRegFile(path string, system, user *MemSource) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := parseRegFile(data, system, user); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// parseRegFile parses the contents of a .reg file, as described by LoadRegFile.
+func parseRegFile(data []byte, system, user *MemSource) error {
+	scanner := bufio.NewScanner(strings.NewReader(decodeText(data)))
+	scanner.Buffer(nil, 1024*1024)
+
+	var (
+		lineNo  int
+		header  string
+		current *MemSource // nil outside of the Environment keys
+		logical string     // value continued on the next line
+	)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if logical != "" {
+			line = logical + strings.TrimLeft(line, " \t")
+			logical = ""
+		}
+		if strings.HasSuffix(line, `\`) && isRegHexValue(line) {
+			logical = strings.TrimSuffix(line, `\`)
+			continue
+		}
+
+		trimmed := strings.TrimLeft(line, " \t")
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, ";"):
+			continue
+		case header == "":
+			if trimmed != regHeader && trimmed != reg4Header {
+				return fmt.Errorf("line %d: not a .reg file, expected %q", lineNo, regHeader)
+			}
+			header = trimmed
+		case strings.HasPrefix(trimmed, "["):
+			if !strings.HasSuffix(trimmed, "]") {
+				return fmt.Errorf("line %d: missing ] in key name", lineNo)
+			}
+			key := strings.TrimSuffix(strings.TrimPrefix(trimmed, "["), "]")
+			current = nil
+			if name, deleted := strings.CutPrefix(key, "-"); deleted {
+				// deleting a key deletes its subkeys, values cannot follow
+				for _, src := range []*MemSource{system, user} {
+					if regEnvironmentAncestors[src.Hive()].MatchString(name) {
+						clear(src.values)
+					}
+				}
+				continue
+			}
+			for _, src := range []*MemSource{system, user} {
+				if regEnvironmentKeys[src.Hive()].MatchString(key) {
+					current = src
+				}
+			}
+		default:
+			name, value, err := parseRegValue(trimmed, header == reg4Header)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			if current == nil || name == "" {
+				// value of another key, or default value which is not a variable
+				continue
+			}
+			if value.valtype == regDelete {
+				current.remove(name)
+				continue
+			}
+			current.values[name] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if header == "" {
+		return fmt.Errorf("not a .reg file, expected %q", regHeader)
+	}
+	return nil
+}
+
+// regDelete is returned by parseRegValue for values deleted with "name"=-.
+const regDelete = ^uint32(0)
+
+// isRegHexValue reports whether a line defines a hexadecimal value, which may be
+// continued on the next line.
+func isRegHexValue(line string) bool {
+	_, data, ok := cutRegName(strings.TrimLeft(line, " \t"))
+	return ok && strings.HasPrefix(strings.ToLower(data), "hex")
+}
+
+// parseRegValue parses a value line of a .reg file, eg. "TEMP"="C:\\Temp".
+//
+// Parameters:
+//   - line: the value line, with continuation lines joined
+//   - ansi: true if strings in hex values are ANSI (REGEDIT4) instead of UTF-16LE
+//
+// Returns the value name (empty for the default value @), and the value converted
+// to a string as described by Source with its registry type, or regDelete.
+func parseRegValue(line string, ansi bool) (string, memValue, error) {
+	name, data, ok := cutRegName(line)
+	if !ok {
+		return "", memValue{}, fmt.Errorf("invalid value %q", line)
+	}
+	lower := strings.ToLower(data)
+
+	switch {
+	case data == "-":
+		return name, memValue{valtype: regDelete}, nil
+	case strings.HasPrefix(data, `"`):
+		value, rest, ok := cutRegString(data)
+		if !ok || strings.TrimSpace(rest) != "" {
+			return "", memValue{}, fmt.Errorf("invalid string value %s", data)
+		}
+		return name, memValue{data: value, valtype: REG_SZ}, nil
+	case strings.HasPrefix(lower, "dword:"):
+		n, err := strconv.ParseUint(data[len("dword:"):], 16, 32)
+		if err != nil {
+			return "", memValue{}, fmt.Errorf("invalid dword value: %w", err)
+		}
+		return name, memValue{data: strconv.FormatUint(n, 10), valtype: REG_DWORD}, nil
+	case strings.HasPrefix(lower, "hex"):
+		valtype := REG_BINARY
+		typ, digits, ok := strings.Cut(data[len("hex"):], ":")
+		if !ok {
+			return "", memValue{}, fmt.Errorf("invalid hex value %s", data)
+		}
+		if typ != "" {
+			if !strings.HasPrefix(typ, "(") || !strings.HasSuffix(typ, ")") {
+				return "", memValue{}, fmt.Errorf("invalid hex value type %s", typ)
+			}
+			n, err := strconv.ParseUint(typ[1:len(typ)-1], 16, 32)
+			if err != nil {
+				return "", memValue{}, fmt.Errorf("invalid hex value type %s: %w", typ, err)
+			}
+			valtype = uint32(n)
+		}
+		raw, err := hex.DecodeString(strings.NewReplacer(",", "", " ", "", "\t", "").Replace(digits))
+		if err != nil {
+			return "", memValue{}, fmt.Errorf("invalid hex value: %w", err)
+		}
+		if ansi && (valtype == REG_SZ || valtype == REG_EXPAND_SZ || valtype == REG_MULTI_SZ) {
+			raw = ansiToUTF16(raw)
+		}
+		if valtype == REG_MULTI_SZ {
+			entries := multiStrings(raw)
+			return name, memValue{data: strings.Join(entries, ";"), valtype: valtype, entries: entries}, nil
+		}
+		return name, memValue{data: valueString(raw, valtype), valtype: valtype}, nil
+	}
+	return "", memValue{}, fmt.Errorf("invalid value %q", line)
+}
+
+// cutRegName splits a value line into the unquoted value name and the data
+// following the equal sign.
+func cutRegName(line string) (name, data string, ok bool) {
+	rest := line
+	if strings.HasPrefix(line, "@") {
+		rest = line[1:]
+	} else if name, rest, ok = cutRegString(line); !ok {
+		return "", "", false
+	}
+	rest = strings.TrimLeft(rest, " \t")
+	if !strings.HasPrefix(rest, "=") {
+		return "", "", false
+	}
+	return name, strings.TrimSpace(rest[1:]), true
+}
+
+// cutRegString unquotes the string at the start of s, eg. "C:\\Temp", and returns
+// it with the rest of s.
+func cutRegString(s string) (value, rest string, ok bool) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", s, false
+	}
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+			}
+			sb.WriteByte(s[i])
+		case '"':
+			return sb.String(), s[i+1:], true
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return "", s, false
+}
+
+// ansiToUTF16 converts single-byte characters to UTF-16LE, so that REGEDIT4 strings
+// can be converted like the strings of version 5 files.
+func ansiToUTF16(data []byte) []byte {
+	out := make([]byte, 0, 2*len(data))
+	for _, b := range data {
+		out = append(out, b, 0)
+	}
+	return out
+}
+
+// decodeText returns the contents of a text file in UTF-16LE with byte order mark,
+// or in UTF-8 with or without byte order mark.
+func decodeText(data []byte) string {
+	if bytes.HasPrefix(data, []byte{0xff, 0xfe}) {
+		return decodeUTF16(data[2:])
+	}
+	return string(bytes.TrimPrefix(data, []byte{0xef, 0xbb, 0xbf}))
+}
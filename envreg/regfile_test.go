@@ -0,0 +1,226 @@
+package envreg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sampleRegFile is a .reg file with environment variables of both hives.
+const sampleRegFile = `Windows Registry Editor Version 5.00
+
+; exported from a customer machine
+[HKEY_LOCAL_MACHINE\SYSTEM\CurrentControlSet\Control\Session Manager\Environment]
+"OS"="Windows_NT"
+"Path"=hex(2):25,00,53,00,79,00,73,00,74,00,65,00,6d,00,52,00,6f,00,6f,00,74,\
+  00,25,00,5c,00,73,00,79,00,73,00,74,00,65,00,6d,00,33,00,32,00,00,00
+"NUMBER_OF_PROCESSORS"=dword:00000010
+"Obsolete"="remove me"
+"Obsolete"=-
+
+[HKEY_LOCAL_MACHINE\SOFTWARE\Other]
+"Ignored"="not an environment variable"
+
+[HKEY_CURRENT_USER\Environment]
+@="default value"
+"TEMP"=hex(2):25,00,55,00,53,00,45,00,52,00,50,00,52,00,4f,00,46,00,49,00,4c,\
+  00,45,00,25,00,5c,00,54,00,65,00,6d,00,70,00,00,00
+"Quoted"="say \"hi\" in C:\\Temp"
+"Dirs"=hex(7):61,00,00,00,62,00,00,00,00,00
+`
+
+func TestParseRegFile(t *testing.T) {
+	system, user := NewMemSource(HKLM), NewMemSource(HKCU)
+	if err := parseRegFile([]byte(sampleRegFile), system, user); err != nil {
+		t.Fatalf("parseRegFile() error = %v", err)
+	}
+
+	expectedSystem := map[string]memValue{
+		"OS":                   {data: "Windows_NT", valtype: REG_SZ},
+		"Path":                 {data: `%SystemRoot%\system32`, valtype: REG_EXPAND_SZ},
+		"NUMBER_OF_PROCESSORS": {data: "16", valtype: REG_DWORD},
+	}
+	if !reflect.DeepEqual(system.values, expectedSystem) {
+		t.Errorf("system values = %v, want %v", system.values, expectedSystem)
+	}
+	expectedUser := map[string]memValue{
+		"TEMP":   {data: `%USERPROFILE%\Temp`, valtype: REG_EXPAND_SZ},
+		"Quoted": {data: `say "hi" in C:\Temp`, valtype: REG_SZ},
+		"Dirs":   {data: "a;b", valtype: REG_MULTI_SZ, entries: []string{"a", "b"}},
+	}
+	if !reflect.DeepEqual(user.values, expectedUser) {
+		t.Errorf("user values = %v, want %v", user.values, expectedUser)
+	}
+}
+
+func TestParseRegFile_Variants(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected map[string]memValue
+	}{
+		{
+			name: "UTF-16LE with byte order mark and CRLF",
+			data: encodeUTF16("Windows Registry Editor Version 5.00\r\n\r\n[HKEY_CURRENT_USER\\Environment]\r\n\"A\"=\"1\"\r\n"),
+			expected: map[string]memValue{
+				"A": {data: "1", valtype: REG_SZ},
+			},
+		},
+		{
+			name: "UTF-8 with byte order mark",
+			data: []byte("\xef\xbb\xbfWindows Registry Editor Version 5.00\n[HKCU\\Environment]\n\"A\"=\"1\"\n"),
+			expected: map[string]memValue{
+				"A": {data: "1", valtype: REG_SZ},
+			},
+		},
+		{
+			name: "REGEDIT4 with ANSI strings",
+			data: []byte("REGEDIT4\n[HKEY_CURRENT_USER\\Environment]\n\"A\"=hex(2):25,41,25,00\n"),
+			expected: map[string]memValue{
+				"A": {data: "%A%", valtype: REG_EXPAND_SZ},
+			},
+		},
+		{
+			name: "other user and deleted key",
+			data: []byte("Windows Registry Editor Version 5.00\n" +
+				"[HKEY_USERS\\S-1-5-21-1000\\Environment]\n\"A\"=\"1\"\n\"B\"=\"2\"\n" +
+				"[-HKEY_USERS\\S-1-5-21-1000\\Environment]\n" +
+				"[HKEY_USERS\\S-1-5-21-1000\\Environment]\n\"C\"=\"3\"\n"),
+			expected: map[string]memValue{
+				"C": {data: "3", valtype: REG_SZ},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			system, user := NewMemSource(HKLM), NewMemSource(HKCU)
+			if err := parseRegFile(tt.data, system, user); err != nil {
+				t.Fatalf("parseRegFile() error = %v", err)
+			}
+			if !reflect.DeepEqual(user.values, tt.expected) {
+				t.Errorf("user values = %v, want %v", user.values, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseRegFile_DeletedAncestor(t *testing.T) {
+	const values = "Windows Registry Editor Version 5.00\n" +
+		"[HKEY_LOCAL_MACHINE\\SYSTEM\\CurrentControlSet\\Control\\Session Manager\\Environment]\n\"OS\"=\"Windows_NT\"\n" +
+		"[HKEY_CURRENT_USER\\Environment]\n\"TEMP\"=\"C:\\\\Temp\"\n"
+	tests := []struct {
+		key                  string
+		systemVars, userVars int
+	}{
+		{key: `HKEY_CURRENT_USER`, systemVars: 1, userVars: 0},
+		{key: `HKU\S-1-5-21-1000`, systemVars: 1, userVars: 0},
+		{key: `HKEY_LOCAL_MACHINE\SYSTEM\CurrentControlSet\Control`, systemVars: 0, userVars: 1},
+		{key: `hklm\system`, systemVars: 0, userVars: 1},
+		{key: `HKEY_CURRENT_USER\Software`, systemVars: 1, userVars: 1},
+		{key: `HKEY_LOCAL_MACHINE\SOFTWARE`, systemVars: 1, userVars: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			system, user := NewMemSource(HKLM), NewMemSource(HKCU)
+			if err := parseRegFile([]byte(values+"[-"+tt.key+"]\n"), system, user); err != nil {
+				t.Fatalf("parseRegFile() error = %v", err)
+			}
+			if len(system.values) != tt.systemVars || len(user.values) != tt.userVars {
+				t.Errorf("parseRegFile() = %d system and %d user variables, want %d and %d",
+					len(system.values), len(user.values), tt.systemVars, tt.userVars)
+			}
+		})
+	}
+}
+
+func TestParseRegFile_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"empty", "", "not a .reg file"},
+		{"missing header", "[HKEY_CURRENT_USER\\Environment]\n", "line 1: not a .reg file"},
+		{"unterminated key", "REGEDIT4\n[HKEY_CURRENT_USER\\Environment\n", "line 2: missing ]"},
+		{"invalid value", "REGEDIT4\n[HKEY_CURRENT_USER\\Environment]\nA=1\n", "line 3: invalid value"},
+		{"invalid dword", "REGEDIT4\n[HKEY_CURRENT_USER\\Environment]\n\"A\"=dword:xyz\n", "line 3: invalid dword value"},
+		{"invalid hex", "REGEDIT4\n[HKEY_CURRENT_USER\\Environment]\n\"A\"=hex(2):4\n", "line 3: invalid hex value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseRegFile([]byte(tt.data), NewMemSource(HKLM), NewMemSource(HKCU))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseRegFile() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseRegFile_RoundTrip(t *testing.T) {
+	system, user := fixtureSources()
+	system.Set("Dirs", "a;b", REG_MULTI_SZ)
+	system.SetStrings("Quoted", []string{`C:\My;Tools`, `say "hi"`})
+	system.Set("Count", "42", REG_DWORD)
+	user.Set("Quoted", `say "hi" \o/`, REG_SZ)
+	env, err := Read(context.Background(), Options{
+		System: system,
+		User:   user,
+	})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	data, err := env.regFile()
+	if err != nil {
+		t.Fatalf("regFile() error = %v", err)
+	}
+
+	gotSystem, gotUser := NewMemSource(HKLM), NewMemSource(HKCU)
+	if err := parseRegFile(data, gotSystem, gotUser); err != nil {
+		t.Fatalf("parseRegFile() error = %v", err)
+	}
+	if !reflect.DeepEqual(gotSystem.values, system.values) {
+		t.Errorf("system values = %v, want %v", gotSystem.values, system.values)
+	}
+	if !reflect.DeepEqual(gotUser.values, user.values) {
+		t.Errorf("user values = %v, want %v", gotUser.values, user.values)
+	}
+}
+
+func TestLoadRegFile_Pipeline(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.reg")
+	second := filepath.Join(dir, "second.reg")
+	if err := os.WriteFile(first, []byte(sampleRegFile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	override := "Windows Registry Editor Version 5.00\n[HKEY_CURRENT_USER\\Environment]\n" +
+		"\"Path\"=\"%TEMP%\\\\bin\"\n\"USERPROFILE\"=\"C:\\\\Users\\\\me\"\n"
+	if err := os.WriteFile(second, []byte(override), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	system, user := NewMemSource(HKLM), NewMemSource(HKCU)
+	for _, path := range []string{first, second} {
+		if err := LoadRegFile(path, system, user); err != nil {
+			t.Fatalf("LoadRegFile() error = %v", err)
+		}
+	}
+	env, err := Read(context.Background(), Options{System: system, User: user, Expand: true})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	expected := `%SystemRoot%\system32;C:\Users\me\Temp\bin`
+	if got := env.Variables["Path"].Value; got != expected {
+		t.Errorf("Path = %q, want %q", got, expected)
+	}
+}
+
+func TestLoadRegFile_NotFound(t *testing.T) {
+	err := LoadRegFile(filepath.Join(t.TempDir(), "missing.reg"), NewMemSource(HKLM), NewMemSource(HKCU))
+	if err == nil {
+		t.Error("LoadRegFile() expected error for missing file")
+	}
+}
@@ -0,0 +1,144 @@
+//go:build windows
+
+package envreg
+
+import (
+	"context"
+	"encoding/hex"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// notifyPoll is how often Watch checks whether it must stop, in milliseconds.
+const notifyPoll = 250
+
+// registrySource reads environment variables from the live Windows registry.
+type registrySource struct {
+	hive Hive
+	root registry.Key
+	path string
+}
+
+// NewRegistrySource returns a Source reading the Environment key of the specified hive.
+//
+// Parameters:
+//   - hive: HKLM for system variables, HKCU for user variables
+func NewRegistrySource(hive Hive) Source {
+	if hive == HKLM {
+		return &registrySource{hive: hive, root: registry.LOCAL_MACHINE, path: systemKeyPath}
+	}
+	return &registrySource{hive: hive, root: registry.CURRENT_USER, path: userKeyPath}
+}
+
+// NewVolatileSource returns a Source reading the Volatile Environment key of the
+// current user, holding the variables set by Windows at logon, like USERPROFILE
+// or APPDATA.
+func NewVolatileSource() Source {
+	return &registrySource{hive: HKCU, root: registry.CURRENT_USER, path: volatileKeyPath}
+}
+
+// Hive returns the hive the source reads from.
+func (s *registrySource) Hive() Hive {
+	return s.hive
+}
+
+// Names returns the names of all values in the Environment key.
+func (s *registrySource) Names() ([]string, error) {
+	key, err := registry.OpenKey(s.root, s.path, registry.READ)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Close() //nolint:errcheck
+	return key.ReadValueNames(0)
+}
+
+// Value returns the value and registry value type of the named variable,
+// converted to a string as described by Source.
+func (s *registrySource) Value(name string) (string, uint32, error) {
+	key, err := registry.OpenKey(s.root, s.path, registry.READ)
+	if err != nil {
+		return "", 0, err
+	}
+	defer key.Close() //nolint:errcheck
+
+	// query the type and size first, then read the value according to its type
+	n, valtype, err := key.GetValue(name, nil)
+	if err != nil {
+		return "", valtype, err
+	}
+	switch valtype {
+	case registry.SZ, registry.EXPAND_SZ:
+		return key.GetStringValue(name)
+	case registry.MULTI_SZ:
+		val, _, err := key.GetStringsValue(name)
+		return strings.Join(val, ";"), valtype, err
+	case registry.DWORD, registry.QWORD:
+		val, _, err := key.GetIntegerValue(name)
+		return strconv.FormatUint(val, 10), valtype, err
+	default:
+		buf := make([]byte, n)
+		n, _, err = key.GetValue(name, buf)
+		return hex.EncodeToString(buf[:n]), valtype, err
+	}
+}
+
+// Strings returns the entries of the named REG_MULTI_SZ value.
+func (s *registrySource) Strings(name string) ([]string, error) {
+	key, err := registry.OpenKey(s.root, s.path, registry.READ)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Close() //nolint:errcheck
+	val, _, err := key.GetStringsValue(name)
+	return val, err
+}
+
+// Watch returns a channel receiving a value after values of the key are added,
+// removed or changed, until ctx is done.
+func (s *registrySource) Watch(ctx context.Context) (<-chan struct{}, error) {
+	key, err := registry.OpenKey(s.root, s.path, registry.NOTIFY)
+	if err != nil {
+		return nil, err
+	}
+	event, err := windows.CreateEvent(nil, 0, 0, nil)
+	if err != nil {
+		key.Close() //nolint:errcheck
+		return nil, err
+	}
+
+	ch := make(chan struct{}, 1)
+	go func() {
+		// the notification is cancelled when the thread that registered it exits
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		defer close(ch)
+		defer windows.CloseHandle(event) //nolint:errcheck
+		defer key.Close()                //nolint:errcheck
+
+		for {
+			err := windows.RegNotifyChangeKeyValue(windows.Handle(key), false, windows.REG_NOTIFY_CHANGE_LAST_SET, event, true)
+			if err != nil {
+				return
+			}
+			for {
+				if ctx.Err() != nil {
+					return
+				}
+				if r, err := windows.WaitForSingleObject(event, notifyPoll); err != nil {
+					return
+				} else if r == windows.WAIT_OBJECT_0 {
+					break
+				}
+			}
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+
+package envreg
+
+import "errors"
+
+var errNoRegistry = errors.New("the Windows registry is not available on this platform")
+
+// registrySource stands in for the Windows registry on other platforms.
+// All reads fail with errNoRegistry.
+type registrySource struct {
+	hive Hive
+}
+
+// NewRegistrySource returns a Source for the specified hive that always fails.
+func NewRegistrySource(hive Hive) Source {
+	return &registrySource{hive: hive}
+}
+
+// NewVolatileSource returns a Source for the Volatile Environment key that always fails.
+func NewVolatileSource() Source {
+	return &registrySource{hive: HKCU}
+}
+
+// Hive returns the hive the source was created for.
+func (s *registrySource) Hive() Hive {
+	return s.hive
+}
+
+// Names always fails with errNoRegistry.
+func (s *registrySource) Names() ([]string, error) {
+	return nil, errNoRegistry
+}
+
+// Value always fails with errNoRegistry.
+func (s *registrySource) Value(name string) (string, uint32, error) {
+	return "", 0, errNoRegistry
+}
+
+// Strings always fails with errNoRegistry.
+func (s *registrySource) Strings(name string) ([]string, error) {
+	return nil, errNoRegistry
+}
@@ -0,0 +1,121 @@
+package envreg
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// pathStyles are the supported translations of Windows paths for shell formats,
+// with the directory drives are mounted on. Paths are not translated for "windows"
+// (or an empty style).
+var pathStyles = map[string]string{
+	"windows": "",
+	"wsl":     "/mnt", // C:\foo -> /mnt/c/foo
+	"msys":    "",     // C:\foo -> /c/foo (Git Bash, MSYS2)
+}
+
+// shellName matches the variable names that can be set by POSIX shells and fish.
+var shellName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// drivePath matches an absolute Windows path with a drive letter, eg. C:\foo.
+var drivePath = regexp.MustCompile(`^([A-Za-z]):(?:[\\/](.*))?$`)
+
+// shellScript returns commands setting the variables in a POSIX shell or in
+// fish. The entries of Path-like variables (those matching the merge policy) are
+// separated with colons instead of semicolons, without the double quotes protecting
+// semicolons in Windows, and empty entries are removed because they stand for the
+// current directory. The values of other variables are translated only if they
+// are a single path, lists like "C:\a;D:\b" are unchanged. The entries of Path
+// are appended to PATH, since shells outside Windows look up commands in PATH
+// only. Variables whose names are not valid shell names, like ProgramFiles(x86),
+// are skipped.
+//
+// Parameters:
+//   - fish: true for fish commands, false for POSIX shell commands
+//   - style: the translation of paths, see pathStyles
+func (env *Environment) shellScript(fish bool, style string) string {
+	var sb strings.Builder
+	sb.WriteString("# Environment variables exported by peekenv\n")
+	for _, name := range env.Names() {
+		if !shellName.MatchString(name) {
+			fmt.Fprintf(&sb, "# skipped %s: not a valid shell variable name\n", name)
+			continue
+		}
+
+		v := env.Variables[name]
+		value := v.Value
+		if !env.Merge.Merges(name) {
+			if !strings.Contains(value, ";") {
+				// lists of paths are only translated entry by entry if merged
+				value = translatePath(value, style)
+			}
+			if fish {
+				fmt.Fprintf(&sb, "set -gx %s %s\n", name, fishQuote(value))
+			} else {
+				fmt.Fprintf(&sb, "export %s=%s\n", name, shQuote(value))
+			}
+			continue
+		}
+
+		var entries []string
+		for _, entry := range v.Entries() {
+			if entry = UnquoteEntry(entry); entry != "" {
+				entries = append(entries, translatePath(entry, style))
+			}
+		}
+		appendPath := strings.EqualFold(name, "Path")
+		if appendPath && len(entries) == 0 {
+			fmt.Fprintf(&sb, "# skipped %s: no entries to append to PATH\n", name)
+			continue
+		}
+		switch {
+		case fish && appendPath:
+			sb.WriteString("set -gx --path PATH $PATH" + fishWords(entries) + "\n")
+		case fish:
+			// path variables are joined with colons when exported
+			sb.WriteString("set -gx --path " + name + fishWords(entries) + "\n")
+		case appendPath:
+			fmt.Fprintf(&sb, "export PATH=\"$PATH\":%s\n", shQuote(strings.Join(entries, ":")))
+		default:
+			fmt.Fprintf(&sb, "export %s=%s\n", name, shQuote(strings.Join(entries, ":")))
+		}
+	}
+	return sb.String()
+}
+
+// translatePath converts an absolute Windows path with a drive letter to the
+// specified style, eg. C:\foo to /mnt/c/foo for "wsl". Other values are unchanged.
+func translatePath(s, style string) string {
+	m := drivePath.FindStringSubmatch(s)
+	if style == "windows" || style == "" || m == nil {
+		return s
+	}
+	translated := pathStyles[style] + "/" + strings.ToLower(m[1])
+	if m[2] != "" {
+		translated += "/" + strings.ReplaceAll(m[2], `\`, "/")
+	}
+	return translated
+}
+
+// shQuote returns s as a single-quoted POSIX shell word, where only the single
+// quote needs to be escaped: the quotes are closed, the quote is escaped with a
+// backslash, and the quotes are opened again.
+func shQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// fishQuote returns s as a single-quoted fish word, where backslashes and
+// single quotes are escaped with a backslash.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+// fishWords returns the entries as fish words, each preceded by a space.
+func fishWords(entries []string) string {
+	var sb strings.Builder
+	for _, entry := range entries {
+		sb.WriteString(" " + fishQuote(entry))
+	}
+	return sb.String()
+}
@@ -0,0 +1,144 @@
+package envreg
+
+import (
+	"testing"
+)
+
+// shellFixture returns an environment with Windows paths, lists with quoted entries,
+// and names that are not valid in shells.
+func shellFixture() *Environment {
+	return &Environment{
+		Variables: map[string]Variable{
+			"Path":              {Value: `C:\Windows\system32;;"D:\My;Tools";D:\Tools\bin;%USERPROFILE%\bin`, Type: REG_EXPAND_SZ, Hive: HKLM | HKCU},
+			"JAVA_HOME":         {Value: `C:\Program Files\Java\jdk-21`, Type: REG_SZ, Hive: HKLM},
+			"PATHEXT":           {Value: ".COM;.EXE", Type: REG_SZ, Hive: HKLM},
+			"CLASSPATH":         {Value: `C:\lib\a.jar;D:\lib`, Type: REG_SZ, Hive: HKCU},
+			"GREETING":          {Value: "it's $HOME", Type: REG_SZ, Hive: HKCU},
+			"ProgramFiles(x86)": {Value: `C:\Program Files (x86)`, Type: REG_SZ, Hive: HKLM},
+		},
+	}
+}
+
+func TestEnvironment_ShellScript(t *testing.T) {
+	tests := []struct {
+		name     string
+		fish     bool
+		style    string
+		expected string
+	}{
+		{
+			name:  "sh windows paths",
+			style: "windows",
+			expected: `# Environment variables exported by peekenv
+export CLASSPATH='C:\lib\a.jar;D:\lib'
+export GREETING='it'\''s $HOME'
+export JAVA_HOME='C:\Program Files\Java\jdk-21'
+export PATH="$PATH":'C:\Windows\system32:D:\My;Tools:D:\Tools\bin:%USERPROFILE%\bin'
+export PATHEXT='.COM;.EXE'
+# skipped ProgramFiles(x86): not a valid shell variable name
+`,
+		},
+		{
+			name:  "sh wsl paths",
+			style: "wsl",
+			expected: `# Environment variables exported by peekenv
+export CLASSPATH='C:\lib\a.jar;D:\lib'
+export GREETING='it'\''s $HOME'
+export JAVA_HOME='/mnt/c/Program Files/Java/jdk-21'
+export PATH="$PATH":'/mnt/c/Windows/system32:/mnt/d/My;Tools:/mnt/d/Tools/bin:%USERPROFILE%\bin'
+export PATHEXT='.COM;.EXE'
+# skipped ProgramFiles(x86): not a valid shell variable name
+`,
+		},
+		{
+			name:  "fish msys paths",
+			fish:  true,
+			style: "msys",
+			expected: `# Environment variables exported by peekenv
+set -gx CLASSPATH 'C:\\lib\\a.jar;D:\\lib'
+set -gx GREETING 'it\'s $HOME'
+set -gx JAVA_HOME '/c/Program Files/Java/jdk-21'
+set -gx --path PATH $PATH '/c/Windows/system32' '/d/My;Tools' '/d/Tools/bin' '%USERPROFILE%\\bin'
+set -gx PATHEXT '.COM;.EXE'
+# skipped ProgramFiles(x86): not a valid shell variable name
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shellFixture().shellScript(tt.fish, tt.style); got != tt.expected {
+				t.Errorf("shellScript() =\n%s\nwant\n%s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEnvironment_ShellScript_MergedVariables(t *testing.T) {
+	env := &Environment{
+		Variables: map[string]Variable{
+			"PATH":         {Value: ";", Type: REG_EXPAND_SZ, Hive: HKLM | HKCU},
+			"PsModulePath": {Value: `C:\Modules;D:\Modules`, Type: REG_EXPAND_SZ, Hive: HKLM | HKCU},
+		},
+	}
+	tests := []struct {
+		name     string
+		fish     bool
+		expected string
+	}{
+		{
+			name: "sh",
+			expected: `# Environment variables exported by peekenv
+# skipped PATH: no entries to append to PATH
+export PsModulePath='C:\Modules:D:\Modules'
+`,
+		},
+		{
+			name: "fish",
+			fish: true,
+			expected: `# Environment variables exported by peekenv
+# skipped PATH: no entries to append to PATH
+set -gx --path PsModulePath 'C:\\Modules' 'D:\\Modules'
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := env.shellScript(tt.fish, "windows"); got != tt.expected {
+				t.Errorf("shellScript() =\n%s\nwant\n%s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTranslatePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		style    string
+		expected string
+	}{
+		{`C:\foo\bar`, "wsl", "/mnt/c/foo/bar"},
+		{`C:\foo\bar`, "msys", "/c/foo/bar"},
+		{`C:\foo\bar`, "windows", `C:\foo\bar`},
+		{`C:\foo\bar`, "", `C:\foo\bar`},
+		{`d:/mixed\slashes`, "wsl", "/mnt/d/mixed/slashes"},
+		{`C:\`, "msys", "/c"},
+		{`C:`, "wsl", "/mnt/c"},
+		{`\\server\share`, "wsl", `\\server\share`},
+		{`relative\path`, "wsl", `relative\path`},
+		{`C:foo`, "wsl", `C:foo`},
+	}
+	for _, tt := range tests {
+		if got := translatePath(tt.path, tt.style); got != tt.expected {
+			t.Errorf("translatePath(%q, %q) = %q, want %q", tt.path, tt.style, got, tt.expected)
+		}
+	}
+}
+
+func TestShellQuoting(t *testing.T) {
+	if got := shQuote(`a'b\c`); got != `'a'\''b\c'` {
+		t.Errorf("shQuote() = %s", got)
+	}
+	if got := fishQuote(`a'b\c`); got != `'a\'b\\c'` {
+		t.Errorf("fishQuote() = %s", got)
+	}
+}
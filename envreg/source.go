@@ -0,0 +1,244 @@
+package envreg
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Hive identifies the registry hive environment variables are read from.
+type Hive int
+
+const (
+	HKLM Hive = 1 << iota // HKEY_LOCAL_MACHINE (system variables)
+	HKCU                  // HKEY_CURRENT_USER (user variables)
+)
+
+// String returns the short name of the hive, eg. HKLM.
+func (h Hive) String() string {
+	switch h {
+	case HKLM:
+		return "HKLM"
+	case HKCU:
+		return "HKCU"
+	case HKLM | HKCU:
+		return "HKLM+HKCU"
+	}
+	return fmt.Sprintf("Hive(%d)", int(h))
+}
+
+// Paths of the Environment keys, relative to the hive.
+const (
+	systemKeyPath = `SYSTEM\CurrentControlSet\Control\Session Manager\Environment`
+	userKeyPath   = `Environment`
+
+	// volatileKeyPath holds the variables Windows sets at logon, eg. USERPROFILE
+	volatileKeyPath = `Volatile Environment`
+)
+
+// Registry value types, as defined in winnt.h.
+const (
+	REG_NONE      uint32 = 0
+	REG_SZ        uint32 = 1
+	REG_EXPAND_SZ uint32 = 2
+	REG_BINARY    uint32 = 3
+	REG_DWORD     uint32 = 4
+	REG_MULTI_SZ  uint32 = 7
+	REG_QWORD     uint32 = 11
+)
+
+// typeNames maps registry value types to their names.
+var typeNames = map[uint32]string{
+	REG_NONE:      "REG_NONE",
+	REG_SZ:        "REG_SZ",
+	REG_EXPAND_SZ: "REG_EXPAND_SZ",
+	REG_BINARY:    "REG_BINARY",
+	REG_DWORD:     "REG_DWORD",
+	REG_MULTI_SZ:  "REG_MULTI_SZ",
+	REG_QWORD:     "REG_QWORD",
+}
+
+// TypeName returns the name of a registry value type, eg. REG_SZ.
+func TypeName(valtype uint32) string {
+	if name, ok := typeNames[valtype]; ok {
+		return name
+	}
+	return fmt.Sprintf("REG_TYPE(%d)", valtype)
+}
+
+// valueString converts the raw data of a registry value to a string, as described
+// by Source. Strings end at the first null character.
+//
+// Parameters:
+//   - data: the value data, as stored in the registry (strings in UTF-16LE)
+//   - valtype: the registry value type
+func valueString(data []byte, valtype uint32) string {
+	switch {
+	case valtype == REG_SZ || valtype == REG_EXPAND_SZ:
+		s, _, _ := strings.Cut(decodeUTF16(data), "\x00")
+		return s
+	case valtype == REG_MULTI_SZ:
+		return strings.Join(multiStrings(data), ";")
+	case valtype == REG_DWORD && len(data) == 4:
+		return strconv.FormatUint(uint64(binary.LittleEndian.Uint32(data)), 10)
+	case valtype == REG_QWORD && len(data) == 8:
+		return strconv.FormatUint(binary.LittleEndian.Uint64(data), 10)
+	}
+	return hex.EncodeToString(data)
+}
+
+// multiStrings returns the entries of the raw data of a REG_MULTI_SZ value, a
+// list of null-terminated UTF-16LE strings ending with an empty string.
+func multiStrings(data []byte) []string {
+	entries := strings.Split(decodeUTF16(data), "\x00")
+	for len(entries) > 0 && entries[len(entries)-1] == "" {
+		entries = entries[:len(entries)-1]
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return entries
+}
+
+// decodeUTF16 decodes UTF-16LE bytes, ignoring a trailing odd byte.
+func decodeUTF16(data []byte) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// Source provides the environment variables of one registry hive. The live
+// Windows registry is one implementation, MemSource is another.
+type Source interface {
+	// Hive returns the hive the variables belong to.
+	Hive() Hive
+
+	// Names returns the names of all variables in the source.
+	Names() ([]string, error)
+
+	// Value returns the value and registry value type of the named variable.
+	// Values are converted to strings: REG_MULTI_SZ entries are joined with
+	// semicolons, REG_DWORD and REG_QWORD are decimal numbers, and other
+	// types are hexadecimal bytes.
+	Value(name string) (string, uint32, error)
+}
+
+// MultiStringSource is implemented by sources returning the entries of REG_MULTI_SZ
+// values as they are stored. Entries containing semicolons or double quotes cannot
+// be recovered from the value returned by Source.Value.
+type MultiStringSource interface {
+	// Strings returns the entries of the named REG_MULTI_SZ value.
+	Strings(name string) ([]string, error)
+}
+
+// memValue is a value stored in a MemSource.
+type memValue struct {
+	data    string
+	valtype uint32
+	entries []string // the entries of REG_MULTI_SZ values
+	err     error    // returned instead of the value if set
+}
+
+// MemSource is an in-memory Source, used for tests, fixture data and the
+// variables loaded from files.
+type MemSource struct {
+	hive   Hive
+	values map[string]memValue
+}
+
+// NewMemSource returns an empty in-memory source for the specified hive.
+func NewMemSource(hive Hive) *MemSource {
+	return &MemSource{
+		hive:   hive,
+		values: make(map[string]memValue),
+	}
+}
+
+// Set stores a variable in the source, replacing any existing value. REG_MULTI_SZ
+// values are split into their entries on semicolons, use SetStrings for entries
+// containing semicolons.
+//
+// Parameters:
+//   - name: the variable name
+//   - value: the variable value
+//   - valtype: the registry value type (eg. REG_SZ)
+func (s *MemSource) Set(name, value string, valtype uint32) {
+	if valtype == REG_MULTI_SZ {
+		var entries []string
+		if value != "" {
+			entries = strings.Split(value, ";")
+		}
+		s.SetStrings(name, entries)
+		return
+	}
+	s.values[name] = memValue{data: value, valtype: valtype}
+}
+
+// SetStrings stores a REG_MULTI_SZ variable in the source, replacing any existing
+// value. Its value is the entries joined with semicolons, as described by Source.
+func (s *MemSource) SetStrings(name string, entries []string) {
+	s.values[name] = memValue{data: strings.Join(entries, ";"), valtype: REG_MULTI_SZ, entries: entries}
+}
+
+// remove deletes the named variable from the source, ignoring case.
+func (s *MemSource) remove(name string) {
+	for k := range s.values {
+		if strings.EqualFold(k, name) {
+			delete(s.values, k)
+		}
+	}
+}
+
+// fail makes reading the named variable return err, like an unreadable registry value.
+func (s *MemSource) fail(name string, err error) {
+	s.values[name] = memValue{err: err}
+}
+
+// Hive returns the hive the source was created for.
+func (s *MemSource) Hive() Hive {
+	return s.hive
+}
+
+// Names returns the variable names in alphabetical order (case-insensitive).
+func (s *MemSource) Names() ([]string, error) {
+	names := make([]string, 0, len(s.values))
+	for name := range s.values {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return strings.ToLower(names[i]) < strings.ToLower(names[j])
+	})
+	return names, nil
+}
+
+// Value returns the value and type of the named variable. Like the registry,
+// names are matched case-insensitively.
+func (s *MemSource) Value(name string) (string, uint32, error) {
+	v, err := s.value(name)
+	return v.data, v.valtype, err
+}
+
+// Strings returns the entries of the named REG_MULTI_SZ value, nil for other types.
+func (s *MemSource) Strings(name string) ([]string, error) {
+	v, err := s.value(name)
+	return v.entries, err
+}
+
+// value returns the named value, ignoring case.
+func (s *MemSource) value(name string) (memValue, error) {
+	if v, ok := s.values[name]; ok {
+		return v, v.err
+	}
+	for k, v := range s.values {
+		if strings.EqualFold(k, name) {
+			return v, v.err
+		}
+	}
+	return memValue{}, fmt.Errorf("%s\\%s: value does not exist", s.hive, name)
+}
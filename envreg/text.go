@@ -0,0 +1,93 @@
+package envreg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tischda/peekenv/v3/section"
+)
+
+// headerStrings are the comments naming the registry keys of each mode.
+var headerStrings = map[Mode]string{
+	User:    "# HKEY_CURRENT_USER\\Environment\n",
+	Machine: "# HKEY_LOCAL_MACHINE\\SYSTEM\\CurrentControlSet\\Control\\Session Manager\\Environment\n",
+	Both:    "# HKEY_LOCAL_MACHINE\\SYSTEM\\CurrentControlSet\\Control\\Session Manager\\Environment\n# HKEY_CURRENT_USER\\Environment\n",
+}
+
+// versionLine is the comment marking the version of the section format.
+var versionLine = section.VersionMarker + strconv.Itoa(section.Version) + "\n"
+
+// header returns the comments naming the registry keys the variables were read
+// from, the export time and the version of the format, followed by an empty line.
+func (env *Environment) header() string {
+	now := time.Now().Format("2006-01-02 15:04:05 -0700 MST")
+	return headerStrings[env.Mode] + fmt.Sprintf("# Exported on %s\n", now) + versionLine + "\n"
+}
+
+// String returns string representation of all variables, formatted like this:
+//
+// [M2_HOME]
+// c:\usr\bin\maven
+
+// [Path]
+// c:\Windows\system32
+// c:\Windows
+//
+// Path type variables with multiple values separated by semicolons will be printed separated by
+// newlines for better readability. This is also the format expected when importing with pokenv.
+// Other values are printed on a single line. Entries that would be ambiguous, eg. containing a
+// line break, are quoted (see section.Quote) and the output starts with the version marker.
+func (env *Environment) String() string {
+	return env.text(FormatOptions{})
+}
+
+// text returns the string representation of all variables, like String. If opts.Header is
+// set, it starts with the header. If opts.Types is set, the registry value type is appended
+// to each section header, eg. "[Path] REG_EXPAND_SZ". If opts.Provenance is set, the hive
+// of the entries is added as comments (see Variable.provenance).
+func (env *Environment) text(opts FormatOptions) string {
+	var sb strings.Builder
+	quoted := false
+
+	// Format output with a section header for each variable
+	for i, originalKey := range env.Names() {
+		if i > 0 {
+			sb.WriteString("\n\n")
+		}
+		sb.WriteString("[" + originalKey + "]")
+		v := env.Variables[originalKey]
+		if opts.Types {
+			sb.WriteString(" " + TypeName(v.Type))
+		}
+		sb.WriteString("\n")
+		lines := quoteAll(v.entries(v.Value, env.isList(originalKey, v)))
+		if opts.Provenance {
+			lines = v.provenance(env.isList(originalKey, v))
+		}
+		for j, line := range lines {
+			if j > 0 {
+				sb.WriteString("\n")
+			}
+			quoted = quoted || strings.HasPrefix(line, "`")
+			sb.WriteString(line)
+		}
+	}
+	sb.WriteString("\n")
+
+	switch {
+	case opts.Header:
+		return env.header() + sb.String()
+	case quoted:
+		// quoted entries are only read as such after the version marker
+		return versionLine + "\n" + sb.String()
+	}
+	return sb.String()
+}
+
+// isList reports whether a variable is a list of entries written one per line:
+// a merged variable, like Path, or a REG_MULTI_SZ value.
+func (env *Environment) isList(name string, v Variable) bool {
+	return env.Merge.Merges(name) || v.Type == REG_MULTI_SZ
+}
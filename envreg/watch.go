@@ -0,0 +1,94 @@
+package envreg
+
+import (
+	"context"
+	"time"
+)
+
+// Watcher is implemented by sources that are notified when their variables
+// change, like the live Windows registry.
+type Watcher interface {
+	// Watch returns a channel receiving a value after the variables of the
+	// source change, until ctx is done. Changes close together may be reported
+	// once, and the channel is closed when watching stops.
+	Watch(ctx context.Context) (<-chan struct{}, error)
+}
+
+// Watch returns a channel receiving a value when the variables of the sources
+// may have changed, so that the environment can be read again. Sources that are
+// Watchers report their changes, other sources are polled every interval.
+//
+// Parameters:
+//   - ctx: watching stops and the channel is closed when ctx is done
+//   - interval: the polling interval of the sources that are not Watchers
+//   - sources: the sources to watch
+//
+// Returns the channel, or an error if a source cannot be watched.
+func Watch(ctx context.Context, interval time.Duration, sources ...Source) (<-chan struct{}, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	var inputs []<-chan struct{}
+	poll := false
+	for _, src := range sources {
+		w, ok := src.(Watcher)
+		if !ok {
+			poll = true
+			continue
+		}
+		ch, err := w.Watch(ctx)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		inputs = append(inputs, ch)
+	}
+	if poll {
+		inputs = append(inputs, tick(ctx, interval))
+	}
+
+	// forward the changes of all sources, a pending change is reported once
+	out := make(chan struct{}, 1)
+	done := make(chan struct{})
+	for _, ch := range inputs {
+		go func() {
+			for range ch {
+				select {
+				case out <- struct{}{}:
+				default:
+				}
+			}
+			done <- struct{}{}
+		}()
+	}
+	go func() {
+		// a source that stops watching stops the others
+		for range inputs {
+			<-done
+			cancel()
+		}
+		close(out)
+	}()
+	return out, nil
+}
+
+// tick returns a channel receiving a value every interval, until ctx is done.
+func tick(ctx context.Context, interval time.Duration) <-chan struct{} {
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			select {
+			case ch <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
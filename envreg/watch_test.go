@@ -0,0 +1,48 @@
+package envreg
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// notifySource is a MemSource that reports the changes sent on its channel.
+type notifySource struct {
+	*MemSource
+	ch chan struct{}
+}
+
+// Watch returns the channel of the source.
+func (s *notifySource) Watch(ctx context.Context) (<-chan struct{}, error) {
+	return s.ch, nil
+}
+
+func TestWatch_Notify(t *testing.T) {
+	src := &notifySource{MemSource: NewMemSource(HKCU), ch: make(chan struct{})}
+	notify, err := Watch(context.Background(), time.Hour, src)
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	src.ch <- struct{}{}
+	if _, ok := <-notify; !ok {
+		t.Fatal("Watch() channel closed, want a change")
+	}
+	close(src.ch)
+	if _, ok := <-notify; ok {
+		t.Error("Watch() channel open after the source stopped")
+	}
+}
+
+func TestWatch_Poll(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	notify, err := Watch(ctx, time.Millisecond, NewMemSource(HKLM), NewMemSource(HKCU))
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	if _, ok := <-notify; !ok {
+		t.Fatal("Watch() channel closed, want a tick")
+	}
+	cancel()
+	for range notify {
+	}
+}
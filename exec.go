@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tischda/peekenv/v3/envreg"
+)
+
+// defaultPathExt are the extensions of executable files when PATHEXT is not set.
+const defaultPathExt = ".COM;.EXE;.BAT;.CMD"
+
+// freshEnv returns the environment of a new process as Explorer would create it
+// from the registry: the variables of the Environment keys, REG_EXPAND_SZ values
+// expanded against each other, the volatile variables set at logon (eg. USERPROFILE) and, for the other
+// variables, the environment of the current process.
+//
+// Parameters:
+//   - p: the peekenv instance reading the Environment keys
+//   - mode: specifies which registry keys to read from
+//   - volatile: the source of the Volatile Environment key
+//   - base: the environment of the current process, as "NAME=value" strings
+//
+// Returns the environment as "NAME=value" strings, or an error if the
+// registry cannot be read.
+func freshEnv(p *peekenv, mode envreg.Mode, volatile envreg.Source, base []string) ([]string, error) {
+	volatileVars, err := readSource(volatile)
+	if err != nil {
+		return nil, fmt.Errorf("reading volatile environment variables: %w", err)
+	}
+
+	// references to variables that are not in the registry, like SystemRoot,
+	// are resolved from the volatile variables, then from the process
+	p.opts.Variables = nil
+	p.opts.LookupEnv = func(name string) (string, bool) {
+		if value, ok := lookupVar(volatileVars, name); ok {
+			return value, true
+		}
+		return lookupVar(environMap(base), name)
+	}
+	if err := p.read(mode, false); err != nil {
+		return nil, err
+	}
+
+	// like Explorer, only REG_EXPAND_SZ values are expanded
+	e := p.env.Expander()
+	registryVars := make(map[string]string, len(p.env.Variables))
+	for name, v := range p.env.Variables {
+		registryVars[name] = expandByType(v, e, p.opts.Merge.Separator())
+	}
+	return buildEnv(base, registryVars, volatileVars), nil
+}
+
+// expandByType returns the value of a variable with the references expanded if
+// it is a REG_EXPAND_SZ value. The parts of a merged variable are expanded
+// according to their own type, and joined with sep.
+func expandByType(v envreg.Variable, e *envreg.Expander, sep string) string {
+	if len(v.Parts) == 0 {
+		if v.Type == envreg.REG_EXPAND_SZ {
+			return e.Expand(v.Value)
+		}
+		return v.Value
+	}
+	values := make([]string, len(v.Parts))
+	for i, pt := range v.Parts {
+		values[i] = pt.Value
+		if pt.Type == envreg.REG_EXPAND_SZ {
+			values[i] = e.Expand(pt.Value)
+		}
+	}
+	return strings.Join(values, sep)
+}
+
+// readSource returns the values of all variables of a source.
+func readSource(src envreg.Source) (map[string]string, error) {
+	names, err := src.Names()
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[string]string, len(names))
+	for _, name := range names {
+		value, _, err := src.Value(name)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", name, err)
+		}
+		vars[name] = value
+	}
+	return vars, nil
+}
+
+// buildEnv returns an environment as "NAME=value" strings sorted by name, made
+// of layers of variables: each layer overrides the variables with the same name
+// (case-insensitive) of the previous layers.
+//
+// Parameters:
+//   - base: the bottom layer, as "NAME=value" strings
+//   - layers: the variables overriding base, in order
+func buildEnv(base []string, layers ...map[string]string) []string {
+	vars := environMap(base)
+	for _, layer := range layers {
+		for name, value := range layer {
+			for k := range vars {
+				if strings.EqualFold(k, name) {
+					delete(vars, k)
+				}
+			}
+			vars[name] = value
+		}
+	}
+
+	env := make([]string, 0, len(vars))
+	for name, value := range vars {
+		env = append(env, name+"="+value)
+	}
+	sort.Slice(env, func(i, j int) bool {
+		return strings.ToLower(env[i]) < strings.ToLower(env[j])
+	})
+	return env
+}
+
+// environMap returns the variables of an environment given as "NAME=value" strings.
+// Entries without '=', and the hidden entries of Windows like "=C:=C:\", are skipped.
+func environMap(environ []string) map[string]string {
+	vars := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if name, value, ok := strings.Cut(kv, "="); ok && name != "" {
+			vars[name] = value
+		}
+	}
+	return vars
+}
+
+// lookupVar returns the value of the named variable (case-insensitive).
+func lookupVar(vars map[string]string, name string) (string, bool) {
+	if value, ok := vars[name]; ok {
+		return value, true
+	}
+	for k, value := range vars {
+		if strings.EqualFold(k, name) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// lookPath returns the executable file run for a command name, searched like
+// Windows in the Path of env, trying the extensions of PATHEXT for names that
+// have none. Names containing a path separator, and names that are not found,
+// are returned unchanged.
+//
+// Parameters:
+//   - file: the command name, eg. "git"
+//   - env: the environment of the command, as "NAME=value" strings
+//   - fsys: the file system searched
+func lookPath(file string, env []string, fsys fileSystem) string {
+	if strings.ContainsAny(file, `/\:`) {
+		return file
+	}
+	vars := environMap(env)
+	path, _ := lookupVar(vars, "Path")
+	pathExt, ok := lookupVar(vars, "PATHEXT")
+	if !ok {
+		pathExt = defaultPathExt
+	}
+	exts := []string{""}
+	if filepath.Ext(file) == "" {
+		exts = strings.Split(pathExt, ";")
+	}
+
+	for _, dir := range envreg.SplitList(path) {
+		if dir = envreg.UnquoteEntry(dir); dir == "" {
+			continue
+		}
+		for _, ext := range exts {
+			candidate := filepath.Join(dir, file+ext)
+			if info, err := fsys.Stat(candidate); err == nil && !info.IsDir() {
+				return candidate
+			}
+		}
+	}
+	return file
+}
+
+// runExec runs a command with the environment read from the registry (see freshEnv),
+// connected to the standard input and output of peekenv.
+//
+// Parameters:
+//   - cfg: the runtime configuration specifying the registry mode
+//   - p: the peekenv instance reading the environment
+//   - volatile: the source of the Volatile Environment key
+//   - args: the command and its arguments
+//
+// Returns the exit code of the command, or an error if the environment cannot be
+// read or the command cannot be started.
+func runExec(cfg *Config, p *peekenv, volatile envreg.Source, args []string) (int, error) {
+	if len(args) < 1 {
+		return 0, fmt.Errorf("usage: %s exec [OPTIONS] -- COMMAND [args...]", name)
+	}
+	env, err := freshEnv(p, cfg.mode(), volatile, os.Environ())
+	if err != nil {
+		return 0, err
+	}
+
+	cmd := exec.Command(lookPath(args[0], env, osFS{}), args[1:]...)
+	cmd.Env = env
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	// the console sends Ctrl+C to the command, which decides how to exit
+	signal.Ignore(os.Interrupt)
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if code := exitErr.ExitCode(); code > 0 {
+			return code, nil
+		}
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/tischda/peekenv/v3/envreg"
+)
+
+func TestBuildEnv(t *testing.T) {
+	base := []string{"PATH=/old", "HOME=/root", "=C:=C:\\"}
+	layers := []map[string]string{
+		{"Path": "/new", "TEMP": "/tmp"},
+		{"temp": "/volatile"},
+	}
+	got := buildEnv(base, layers...)
+	expected := []string{"HOME=/root", "Path=/new", "temp=/volatile"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("buildEnv() = %q, want %q", got, expected)
+	}
+}
+
+func TestFreshEnv(t *testing.T) {
+	system, user := fixtureSources()
+	system.Set("LIT", `100%OS%`, envreg.REG_SZ)
+	volatile := envreg.NewMemSource(envreg.HKCU)
+	volatile.Set("USERPROFILE", `C:\Users\me`, envreg.REG_SZ)
+	base := []string{`SystemRoot=C:\Windows`, `PATH=C:\stale`, `USERPROFILE=C:\Users\old`}
+
+	tests := []struct {
+		name     string
+		mode     envreg.Mode
+		expected []string
+	}{
+		{
+			name: "both",
+			mode: envreg.Both,
+			expected: []string{
+				`LIT=100%OS%`,
+				`M2_HOME=c:\usr\bin\maven`,
+				`OS=Windows_NT`,
+				`Path=C:\Windows\system32;C:\Windows;C:\Users\me\AppData\Local\Microsoft\WindowsApps`,
+				`PsModulePath=%ProgramFiles%\WindowsPowerShell\Modules`,
+				`SystemRoot=C:\Windows`,
+				`TEMP=C:\Users\me\AppData\Local\Temp`,
+				`USERPROFILE=C:\Users\me`,
+			},
+		},
+		{
+			name: "machine",
+			mode: envreg.Machine,
+			expected: []string{
+				`LIT=100%OS%`,
+				`OS=Windows_NT`,
+				`Path=C:\Windows\system32;C:\Windows`,
+				`PsModulePath=%ProgramFiles%\WindowsPowerShell\Modules`,
+				`SystemRoot=C:\Windows`,
+				`TEMP=C:\Windows\TEMP`,
+				`USERPROFILE=C:\Users\me`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &peekenv{
+				opts: envreg.Options{System: system, User: user, Variables: []string{"OS"}},
+			}
+			got, err := freshEnv(p, tt.mode, volatile, base)
+			if err != nil {
+				t.Fatalf("freshEnv() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("freshEnv() =\n%q\nwant:\n%q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLookPath(t *testing.T) {
+	git := filepath.Join(`C:\Git\cmd`, "git.EXE")
+	script := filepath.Join(`C:\tools`, "build.cmd")
+	fsys := fakeFS{
+		`C:\Git\cmd`: true,
+		git:          false,
+		script:       false,
+	}
+	env := []string{`Path=C:\missing;"C:\Git\cmd";C:\tools`, "PATHEXT=.COM;.EXE"}
+
+	tests := []struct {
+		file     string
+		expected string
+	}{
+		{file: "git", expected: git},
+		{file: "build.cmd", expected: script},
+		{file: "build", expected: "build"},
+		{file: `.\git`, expected: `.\git`},
+		{file: "unknown", expected: "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			if got := lookPath(tt.file, env, fsys); got != tt.expected {
+				t.Errorf("lookPath(%q) = %q, want %q", tt.file, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRunExec_NoCommand(t *testing.T) {
+	p := &peekenv{}
+	if _, err := runExec(&Config{}, p, envreg.NewMemSource(envreg.HKCU), nil); err == nil {
+		t.Error("runExec() expected error without command")
+	}
+}
+
+func TestRunExec_ExitCode(t *testing.T) {
+	args := []string{"sh", "-c", "exit 7"}
+	if runtime.GOOS == "windows" {
+		args = []string{"cmd", "/c", "exit 7"}
+	}
+	t.Cleanup(func() { signal.Reset(os.Interrupt) })
+	system, user := fixtureSources()
+	p := &peekenv{opts: envreg.Options{System: system, User: user}}
+
+	code, err := runExec(&Config{}, p, envreg.NewMemSource(envreg.HKCU), args)
+	if err != nil {
+		t.Fatalf("runExec() error = %v", err)
+	}
+	if code != 7 {
+		t.Errorf("runExec() = %d, want 7", code)
+	}
+}
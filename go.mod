@@ -2,4 +2,7 @@ module github.com/tischda/peekenv/v3
 
 go 1.25
 
-require golang.org/x/sys v0.38.0
+require (
+	golang.org/x/sys v0.38.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/tischda/peekenv/v3/envreg"
+)
+
+// grepMatch is a value, or an entry of a Path-like variable, matching a grep pattern.
+type grepMatch struct {
+	variable string
+	index    int // index of the entry, -1 for the whole value
+	entry    string
+	hive     string
+}
+
+// String formats the match, eg. "Path[3]: C:\OldJDK\bin  # HKCU".
+func (m grepMatch) String() string {
+	if m.index < 0 {
+		return fmt.Sprintf("%s: %s  # %s", m.variable, m.entry, m.hive)
+	}
+	return fmt.Sprintf("%s[%d]: %s  # %s", m.variable, m.index, m.entry, m.hive)
+}
+
+// runGrep searches the values of the variables, and the entries of Path-like
+// variables, and writes the matches to w.
+//
+// Parameters:
+//   - cfg: the runtime configuration specifying the registry mode and expansion
+//   - p: the peekenv instance reading the environment
+//   - args: the pattern, followed by the names or patterns of the variables to search
+//   - w: the writer receiving the matches
+//
+// Returns an error if the pattern is invalid or the environment cannot be read.
+func runGrep(cfg *Config, p *peekenv, args []string, w io.Writer) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: %s grep PATTERN [variables...]", name)
+	}
+	match, err := valueMatcher(args[0])
+	if err != nil {
+		return err
+	}
+	p.opts.Variables = args[1:]
+	if err := p.read(cfg.mode(), cfg.expand); err != nil {
+		return err
+	}
+
+	for _, name := range p.env.Names() {
+		for _, m := range grepVariable(name, p.env.Variables[name], p.env.Merge.Merges(name), match) {
+			fmt.Fprintln(w, m)
+		}
+	}
+	return nil
+}
+
+// valueMatcher returns a function reporting whether a value contains the pattern,
+// ignoring case, or matches the regular expression if the pattern is prefixed with "re:".
+//
+// Returns an error if the regular expression is invalid.
+func valueMatcher(pattern string) (func(string) bool, error) {
+	if expr, ok := strings.CutPrefix(pattern, envreg.RegexPrefix); ok {
+		re, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		return re.MatchString, nil
+	}
+	pattern = strings.ToLower(pattern)
+	return func(value string) bool {
+		return strings.Contains(strings.ToLower(value), pattern)
+	}, nil
+}
+
+// grepVariable returns the entries of a list variable, or the values of another
+// variable in each hive (including a system value shadowed by the user value),
+// that match.
+//
+// Parameters:
+//   - name: the name of the variable
+//   - v: the variable
+//   - list: true if the variable is a list of entries, like Path
+//   - match: reports whether a value matches
+func grepVariable(name string, v envreg.Variable, list bool, match func(string) bool) []grepMatch {
+	var matches []grepMatch
+	if !list {
+		for _, pt := range v.HiveValues() {
+			if match(pt.Value) {
+				hive := pt.Hive.String()
+				if v.Shadowed != nil && pt.Hive == v.Shadowed.Hive {
+					hive += " (shadowed)"
+				}
+				matches = append(matches, grepMatch{variable: name, index: -1, entry: pt.Value, hive: hive})
+			}
+		}
+		return matches
+	}
+
+	hives := v.EntryHives()
+	for i, entry := range v.Entries() {
+		if !match(entry) {
+			continue
+		}
+		m := grepMatch{variable: name, index: i, entry: entry, hive: v.Hive.String()}
+		if i < len(hives) {
+			m.hive = hives[i].String()
+		}
+		matches = append(matches, m)
+	}
+	return matches
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tischda/peekenv/v3/envreg"
+)
+
+func TestValueMatcher(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		value    string
+		expected bool
+	}{
+		{"oldjdk", `C:\OldJDK\bin`, true},
+		{`C:\OldJDK`, `c:\oldjdk`, true},
+		{"oldjdk", `C:\jdk-21`, false},
+		{`re:^D:\\`, `d:\tools`, true},
+		{`re:^D:\\`, `C:\D:\tools`, false},
+		{"re:jdk-\\d+$", `C:\Java\jdk-21`, true},
+	}
+	for _, tt := range tests {
+		match, err := valueMatcher(tt.pattern)
+		if err != nil {
+			t.Fatalf("valueMatcher(%q) error = %v", tt.pattern, err)
+		}
+		if got := match(tt.value); got != tt.expected {
+			t.Errorf("valueMatcher(%q)(%q) = %v, want %v", tt.pattern, tt.value, got, tt.expected)
+		}
+	}
+
+	if _, err := valueMatcher("re:("); err == nil {
+		t.Error("valueMatcher() expected error for invalid regular expression")
+	}
+}
+
+func TestRunGrep(t *testing.T) {
+	system := envreg.NewMemSource(envreg.HKLM)
+	system.Set("Path", `C:\Windows;C:\OldJDK\bin`, envreg.REG_SZ)
+	system.Set("JAVA_HOME", `C:\OldJDK`, envreg.REG_SZ)
+	system.Set("OS", "Windows_NT", envreg.REG_SZ)
+	user := envreg.NewMemSource(envreg.HKCU)
+	user.Set("Path", `C:\Tools;c:\oldjdk\jre\bin`, envreg.REG_SZ)
+	user.Set("JAVA_HOME", `C:\jdk-21`, envreg.REG_SZ)
+	user.Set("OLD", `C:\OldJDK`, envreg.REG_SZ)
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name: "all variables",
+			args: []string{"OldJDK"},
+			expected: `JAVA_HOME: C:\OldJDK  # HKLM (shadowed)
+OLD: C:\OldJDK  # HKCU
+Path[1]: C:\OldJDK\bin  # HKLM
+Path[3]: c:\oldjdk\jre\bin  # HKCU
+`,
+		},
+		{
+			name: "selected variables",
+			args: []string{`re:^c:\\oldjdk$`, "java_*", "os"},
+			expected: `JAVA_HOME: C:\OldJDK  # HKLM (shadowed)
+`,
+		},
+		{
+			name:     "no match",
+			args:     []string{"D:"},
+			expected: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &peekenv{
+				opts: envreg.Options{System: system, User: user},
+			}
+			var buf bytes.Buffer
+			if err := runGrep(&Config{}, p, tt.args, &buf); err != nil {
+				t.Fatalf("runGrep() error = %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("runGrep() =\n%s\nwant:\n%s", buf.String(), tt.expected)
+			}
+		})
+	}
+
+	if err := runGrep(&Config{}, &peekenv{}, nil, &bytes.Buffer{}); err == nil {
+		t.Error("runGrep() expected error without pattern")
+	}
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tischda/peekenv/v3/envreg"
+)
+
+// Kinds of lint rules.
+const (
+	ruleRequired        = "required"         // a variable must be defined, optionally in a hive
+	ruleForbidden       = "forbidden"        // a variable, or an entry of a variable, must not be defined
+	rulePattern         = "pattern"          // the value, or each entry, must match a regular expression
+	rulePathOrder       = "path-order"       // the entries matching before must precede those matching after
+	ruleMaxLength       = "max-length"       // the value must not exceed a number of UTF-16 code units
+	ruleHiveRestriction = "hive-restriction" // the values of a hive must be within directories, or not defined
+)
+
+// ruleKeys are the keys allowed in the rules of each kind, in addition to
+// id, kind, variable, severity and message.
+var ruleKeys = map[string][]string{
+	ruleRequired:        {"hive"},
+	ruleForbidden:       {"entry"},
+	rulePattern:         {"pattern", "entries"},
+	rulePathOrder:       {"before", "after"},
+	ruleMaxLength:       {"max"},
+	ruleHiveRestriction: {"hive", "within"},
+}
+
+// Severities of the rules, named like the levels of SARIF.
+var severities = []string{"error", "warning", "note"}
+
+// lintFormats are the output formats of lint.
+var lintFormats = []string{"text", "json", "sarif"}
+
+// lintRule is a rule of a rules file, checked against the variables matching a
+// name or pattern (see envreg.Filter).
+type lintRule struct {
+	id       string
+	kind     string
+	variable string
+	severity string
+	message  string // replaces the problem described by the rule if set
+
+	filter  *envreg.Filter
+	hive    envreg.Hive    // required, hive-restriction
+	entry   *entryPattern  // forbidden
+	pattern *regexp.Regexp // pattern
+	entries bool           // pattern: match each entry instead of the value
+	before  *entryPattern  // path-order
+	after   *entryPattern  // path-order
+	max     int            // max-length
+	within  []string       // hive-restriction
+}
+
+// entryPattern matches the entries of a list: a directory compared like the
+// entries of Path after expansion (ignoring case, quotes and trailing slashes),
+// or a regular expression prefixed with re: matched against the expanded entry.
+type entryPattern struct {
+	text string
+	re   *regexp.Regexp
+}
+
+// newEntryPattern compiles an entry pattern.
+func newEntryPattern(text string) (*entryPattern, error) {
+	ep := &entryPattern{text: text}
+	if expr, ok := strings.CutPrefix(text, "re:"); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		ep.re = re
+	}
+	return ep, nil
+}
+
+// matches reports whether an entry matches the pattern, after expansion with e.
+func (ep *entryPattern) matches(entry string, e *envreg.Expander) bool {
+	if ep.re != nil {
+		return ep.re.MatchString(envreg.UnquoteEntry(e.Expand(entry)))
+	}
+	return entryKey(entry, e) == entryKey(ep.text, e)
+}
+
+// entryKey returns an entry as compared by Windows: expanded, without quotes
+// and trailing slashes, in lower case.
+func entryKey(entry string, e *envreg.Expander) string {
+	return strings.ToLower(strings.TrimRight(envreg.UnquoteEntry(e.Expand(entry)), `\/`))
+}
+
+// newLintRule compiles the fields of a rule read from a rules file.
+//
+// Parameters:
+//   - item: the fields of the rule
+//   - index: the position of the rule in the file, used for the default ID (eg. required-1)
+//
+// Returns the rule, or an error naming the line of an invalid field.
+func newLintRule(item ruleFields, index int) (*lintRule, error) {
+	scalar := func(key string) (string, error) {
+		f := item.fields[key]
+		if f.isList {
+			return "", fmt.Errorf("line %d: %s must be a single value", f.line, key)
+		}
+		return f.value, nil
+	}
+
+	rule := &lintRule{severity: "error"}
+	var err error
+	for _, field := range []struct {
+		key string
+		dst *string
+	}{{"id", &rule.id}, {"kind", &rule.kind}, {"variable", &rule.variable}, {"severity", &rule.severity}, {"message", &rule.message}} {
+		if _, ok := item.fields[field.key]; !ok {
+			continue
+		}
+		if *field.dst, err = scalar(field.key); err != nil {
+			return nil, err
+		}
+	}
+
+	allowed, ok := ruleKeys[rule.kind]
+	switch {
+	case rule.kind == "":
+		return nil, fmt.Errorf("line %d: missing kind", item.line)
+	case !ok:
+		return nil, fmt.Errorf("line %d: unknown rule kind %q", item.fields["kind"].line, rule.kind)
+	case rule.variable == "":
+		return nil, fmt.Errorf("line %d: missing variable", item.line)
+	case !slices.Contains(severities, rule.severity):
+		return nil, fmt.Errorf("line %d: unknown severity %q, expected one of %s",
+			item.fields["severity"].line, rule.severity, strings.Join(severities, ", "))
+	}
+	if rule.id == "" {
+		rule.id = fmt.Sprintf("%s-%d", rule.kind, index+1)
+	}
+	keys := slices.Sorted(maps.Keys(item.fields))
+	for _, key := range keys {
+		f := item.fields[key]
+		if !slices.Contains([]string{"id", "kind", "variable", "severity", "message"}, key) && !slices.Contains(allowed, key) {
+			return nil, fmt.Errorf("line %d: unknown key %q for rule kind %s", f.line, key, rule.kind)
+		}
+	}
+	if rule.filter, err = envreg.NewFilter([]string{rule.variable}, nil); err != nil {
+		return nil, fmt.Errorf("line %d: %w", item.fields["variable"].line, err)
+	}
+
+	// compile the fields of the kind, the required ones are checked below
+	for _, key := range keys {
+		f := item.fields[key]
+		var value string
+		if key != "within" {
+			if value, err = scalar(key); err != nil {
+				return nil, err
+			}
+		}
+		switch key {
+		case "hive":
+			switch strings.ToUpper(value) {
+			case "HKLM":
+				rule.hive = envreg.HKLM
+			case "HKCU":
+				rule.hive = envreg.HKCU
+			default:
+				err = fmt.Errorf("unknown hive %q, expected HKLM or HKCU", value)
+			}
+		case "entry":
+			rule.entry, err = newEntryPattern(value)
+		case "before":
+			rule.before, err = newEntryPattern(value)
+		case "after":
+			rule.after, err = newEntryPattern(value)
+		case "pattern":
+			rule.pattern, err = regexp.Compile(value)
+		case "entries":
+			rule.entries, err = strconv.ParseBool(value)
+		case "max":
+			rule.max, err = strconv.Atoi(value)
+			if err == nil && rule.max <= 0 {
+				err = fmt.Errorf("max must be a positive number")
+			}
+		case "within":
+			rule.within = f.list
+			if !f.isList {
+				rule.within = []string{f.value}
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", f.line, key, err)
+		}
+	}
+
+	missing := ""
+	switch {
+	case rule.kind == rulePattern && rule.pattern == nil:
+		missing = "pattern"
+	case rule.kind == rulePathOrder && rule.before == nil:
+		missing = "before"
+	case rule.kind == rulePathOrder && rule.after == nil:
+		missing = "after"
+	case rule.kind == ruleMaxLength && rule.max == 0:
+		missing = "max"
+	case rule.kind == ruleHiveRestriction && rule.hive == 0:
+		missing = "hive"
+	}
+	if missing != "" {
+		return nil, fmt.Errorf("line %d: missing %s for rule kind %s", item.line, missing, rule.kind)
+	}
+	return rule, nil
+}
+
+// description describes what the rule requires, eg. "JAVA_HOME must be defined in HKLM".
+func (r *lintRule) description() string {
+	if r.message != "" {
+		return r.message
+	}
+	switch r.kind {
+	case ruleRequired:
+		if r.hive != 0 {
+			return fmt.Sprintf("%s must be defined in %s", r.variable, r.hive)
+		}
+		return fmt.Sprintf("%s must be defined", r.variable)
+	case ruleForbidden:
+		if r.entry != nil {
+			return fmt.Sprintf("%s must not contain %s", r.variable, r.entry.text)
+		}
+		return fmt.Sprintf("%s must not be defined", r.variable)
+	case rulePattern:
+		return fmt.Sprintf("%s must match %s", r.variable, r.pattern)
+	case rulePathOrder:
+		return fmt.Sprintf("in %s, %s must come before %s", r.variable, r.before.text, r.after.text)
+	case ruleMaxLength:
+		return fmt.Sprintf("%s must not exceed %d characters", r.variable, r.max)
+	default:
+		if len(r.within) > 0 {
+			return fmt.Sprintf("%s values of %s must be within %s", r.hive, r.variable, strings.Join(r.within, ", "))
+		}
+		return fmt.Sprintf("%s must not be defined in %s", r.variable, r.hive)
+	}
+}
+
+// lintFinding is a violation of a rule.
+type lintFinding struct {
+	rule *lintRule
+	finding
+}
+
+// String formats the finding with its severity and rule, eg.
+// "error: Path[3] (HKCU): .: forbidden entry [no-dot]".
+func (f lintFinding) String() string {
+	return fmt.Sprintf("%s: %s [%s]", f.rule.severity, f.finding, f.rule.id)
+}
+
+// check returns the violations of the rule by the variables of env.
+//
+// Parameters:
+//   - env: the variables to check
+//   - e: the expander used to expand entries before comparing them
+func (r *lintRule) check(env *envreg.Environment, e *envreg.Expander) []lintFinding {
+	var findings []lintFinding
+	report := func(f finding, problem string) {
+		if r.message != "" {
+			problem = r.message
+		}
+		f.problem = problem
+		findings = append(findings, lintFinding{rule: r, finding: f})
+	}
+
+	defined := false
+	for _, name := range env.Names() {
+		if !r.filter.Selects(name) {
+			continue
+		}
+		v := env.Variables[name]
+		whole := finding{variable: name, index: -1, hive: v.Hive.String()}
+		if r.hive == 0 || slices.ContainsFunc(v.HiveValues(), func(pt envreg.Part) bool { return pt.Hive == r.hive }) {
+			defined = true
+		}
+
+		switch r.kind {
+		case ruleForbidden:
+			if r.entry == nil {
+				report(whole, "forbidden variable")
+				continue
+			}
+			for _, f := range listEntries(name, v) {
+				if r.entry.matches(f.entry, e) {
+					report(f, "forbidden entry")
+				}
+			}
+
+		case rulePattern:
+			if !r.entries {
+				if !r.pattern.MatchString(v.Value) {
+					report(whole, "value does not match "+r.pattern.String())
+				}
+				continue
+			}
+			for _, f := range listEntries(name, v) {
+				if !r.pattern.MatchString(f.entry) {
+					report(f, "entry does not match "+r.pattern.String())
+				}
+			}
+
+		case rulePathOrder:
+			list := listEntries(name, v)
+			first := slices.IndexFunc(list, func(f finding) bool {
+				return r.after.matches(f.entry, e) && !r.before.matches(f.entry, e)
+			})
+			if first < 0 {
+				continue
+			}
+			for _, f := range list[first+1:] {
+				if r.before.matches(f.entry, e) && !r.after.matches(f.entry, e) {
+					report(f, fmt.Sprintf("must come before entry %d (%s)", first, list[first].entry))
+				}
+			}
+
+		case ruleMaxLength:
+			if n := utf16Length(v.Value); n > r.max {
+				report(whole, fmt.Sprintf("length %d exceeds %d characters", n, r.max))
+			}
+
+		case ruleHiveRestriction:
+			r.checkHive(name, v, e, report)
+		}
+	}
+
+	if r.kind == ruleRequired && !defined {
+		problem := "required variable is not defined"
+		if r.hive != 0 {
+			problem += " in " + r.hive.String()
+		}
+		report(finding{variable: r.variable, index: -1}, problem)
+	}
+	return findings
+}
+
+// checkHive reports the values of the variable read from the hive of the rule:
+// all of them if the rule has no directories, otherwise the entries that are not
+// within one of the directories. A system value shadowed by a user value is also
+// checked.
+func (r *lintRule) checkHive(name string, v envreg.Variable, e *envreg.Expander, report func(finding, string)) {
+	list := listEntries(name, v)
+	if v.Shadowed != nil && v.Shadowed.Hive == r.hive {
+		list = listEntries(name, *v.Shadowed)
+	}
+	var inHive []finding
+	for _, f := range list {
+		if f.hive == r.hive.String() {
+			inHive = append(inHive, f)
+		}
+	}
+	if len(inHive) == 0 {
+		return
+	}
+	if len(r.within) == 0 {
+		report(finding{variable: name, index: -1, hive: r.hive.String()}, "defined in "+r.hive.String())
+		return
+	}
+	for _, f := range inHive {
+		key := entryKey(f.entry, e)
+		if !slices.ContainsFunc(r.within, func(dir string) bool {
+			dir = entryKey(dir, e)
+			return key == dir || strings.HasPrefix(key, dir+`\`) || strings.HasPrefix(key, dir+"/")
+		}) {
+			report(f, "entry outside "+strings.Join(r.within, ", "))
+		}
+	}
+}
+
+// listEntries returns the entries of a variable value with their index and hive.
+func listEntries(name string, v envreg.Variable) []finding {
+	hives := v.EntryHives()
+	var list []finding
+	for i, entry := range v.Entries() {
+		f := finding{variable: name, index: i, entry: entry, hive: v.Hive.String()}
+		if i < len(hives) {
+			f.hive = hives[i].String()
+		}
+		list = append(list, f)
+	}
+	return list
+}
+
+// runLint checks the environment against the rules of cfg.rules and writes the
+// violations to w, in the text, json or sarif format.
+//
+// Parameters:
+//   - cfg: the runtime configuration specifying the rules file, registry mode and format
+//   - p: the peekenv instance reading the environment
+//   - args: must be empty, all variables are read
+//   - w: the writer receiving the report
+//
+// Returns true if rules with severity error are violated, or an error if the rules
+// or the environment cannot be read.
+func runLint(cfg *Config, p *peekenv, args []string, w io.Writer) (bool, error) {
+	if len(args) > 0 || cfg.rules == "" {
+		return false, fmt.Errorf("usage: %s lint --rules FILE", name)
+	}
+	if !slices.Contains(lintFormats, cfg.format) {
+		return false, fmt.Errorf("lint supports the %s formats, not %s", strings.Join(lintFormats, ", "), cfg.format)
+	}
+	rules, err := loadRules(cfg.rules)
+	if err != nil {
+		return false, err
+	}
+	p.opts.Variables = nil
+	if err := p.read(cfg.mode(), cfg.expand); err != nil {
+		return false, err
+	}
+
+	var findings []lintFinding
+	e := p.env.Expander()
+	failed := false
+	for _, rule := range rules {
+		for _, f := range rule.check(p.env, e) {
+			findings = append(findings, f)
+			failed = failed || rule.severity == "error"
+		}
+	}
+
+	switch cfg.format {
+	case "json":
+		err = writeLintJSON(w, findings)
+	case "sarif":
+		err = writeSARIF(w, rules, findings)
+	default:
+		for _, f := range findings {
+			fmt.Fprintln(w, f)
+		}
+	}
+	return failed, err
+}
+
+// jsonFinding is the JSON representation of a lint finding.
+type jsonFinding struct {
+	Rule     string `json:"rule"`
+	Kind     string `json:"kind"`
+	Severity string `json:"severity"`
+	Variable string `json:"variable"`
+	Index    *int   `json:"index,omitempty"`
+	Entry    string `json:"entry,omitempty"`
+	Hive     string `json:"hive,omitempty"`
+	Message  string `json:"message"`
+}
+
+// writeLintJSON writes the findings as an indented JSON array.
+func writeLintJSON(w io.Writer, findings []lintFinding) error {
+	out := make([]jsonFinding, 0, len(findings))
+	for _, f := range findings {
+		jf := jsonFinding{
+			Rule:     f.rule.id,
+			Kind:     f.rule.kind,
+			Severity: f.rule.severity,
+			Variable: f.variable,
+			Entry:    f.entry,
+			Hive:     f.hive,
+			Message:  f.problem,
+		}
+		if f.index >= 0 {
+			jf.Index = &f.index
+		}
+		out = append(out, jf)
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tischda/peekenv/v3/envreg"
+)
+
+// lintEnv returns the environment checked by the lint tests.
+func lintEnv(t *testing.T) *envreg.Environment {
+	t.Helper()
+	system := envreg.NewMemSource(envreg.HKLM)
+	system.Set("Path", `C:\Tools;%SystemRoot%\system32;.`, envreg.REG_EXPAND_SZ)
+	system.Set("JAVA_HOME", `C:\jdk`, envreg.REG_SZ)
+	system.Set("SystemRoot", `C:\Windows`, envreg.REG_SZ)
+	user := envreg.NewMemSource(envreg.HKCU)
+	user.Set("Path", `%USERPROFILE%\bin;D:\bin`, envreg.REG_EXPAND_SZ)
+	user.Set("JAVA_HOME", `C:\Users\me\jdk`, envreg.REG_SZ)
+	user.Set("M2_HOME", `/usr/maven`, envreg.REG_SZ)
+	user.Set("USERPROFILE", `C:\Users\me`, envreg.REG_SZ)
+
+	policy, err := envreg.NewMergePolicy("Path", "system", ";")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := envreg.Read(context.Background(), envreg.Options{System: system, User: user, Merge: policy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func TestLintRule_Check(t *testing.T) {
+	tests := []struct {
+		name     string
+		fields   map[string]string
+		expected []string
+	}{
+		{
+			name:     "required",
+			fields:   map[string]string{"kind": "required", "variable": "GOPATH"},
+			expected: []string{"error: GOPATH: required variable is not defined [required-1]"},
+		},
+		{
+			name:     "required in hive",
+			fields:   map[string]string{"kind": "required", "variable": "JAVA_HOME", "hive": "HKLM"},
+			expected: nil,
+		},
+		{
+			name:     "required in hive missing",
+			fields:   map[string]string{"kind": "required", "variable": "M2_HOME", "hive": "HKLM"},
+			expected: []string{"error: M2_HOME: required variable is not defined in HKLM [required-1]"},
+		},
+		{
+			name:     "forbidden variable",
+			fields:   map[string]string{"id": "no-m2", "kind": "forbidden", "variable": "M2_*", "severity": "warning"},
+			expected: []string{"warning: M2_HOME: forbidden variable [no-m2]"},
+		},
+		{
+			name:     "forbidden entry",
+			fields:   map[string]string{"kind": "forbidden", "variable": "Path", "entry": "."},
+			expected: []string{"error: Path[2] (HKLM): .: forbidden entry [forbidden-1]"},
+		},
+		{
+			name:     "forbidden entry expanded",
+			fields:   map[string]string{"kind": "forbidden", "variable": "Path", "entry": `c:\windows\System32\`, "message": "use the system Path"},
+			expected: []string{`error: Path[1] (HKLM): %SystemRoot%\system32: use the system Path [forbidden-1]`},
+		},
+		{
+			name:     "pattern",
+			fields:   map[string]string{"kind": "pattern", "variable": "*_HOME", "pattern": `^[A-Za-z]:\\`},
+			expected: []string{`error: M2_HOME: value does not match ^[A-Za-z]:\\ [pattern-1]`},
+		},
+		{
+			name:     "pattern entries",
+			fields:   map[string]string{"kind": "pattern", "variable": "Path", "pattern": `^[A-Z%]`, "entries": "true"},
+			expected: []string{`error: Path[2] (HKLM): .: entry does not match ^[A-Z%] [pattern-1]`},
+		},
+		{
+			name:     "path order",
+			fields:   map[string]string{"kind": "path-order", "variable": "Path", "before": `C:\Windows\system32`, "after": `re:(?i)^c:\\tools`},
+			expected: []string{`error: Path[1] (HKLM): %SystemRoot%\system32: must come before entry 0 (C:\Tools) [path-order-1]`},
+		},
+		{
+			name:     "max length",
+			fields:   map[string]string{"kind": "max-length", "variable": "re:HOME$", "max": "10"},
+			expected: []string{"error: JAVA_HOME: length 15 exceeds 10 characters [max-length-1]"},
+		},
+		{
+			name:   "hive restriction within",
+			fields: map[string]string{"kind": "hive-restriction", "variable": "Path", "hive": "HKCU", "within": `%USERPROFILE%`},
+			expected: []string{
+				`error: Path[4] (HKCU): D:\bin: entry outside %USERPROFILE% [hive-restriction-1]`,
+			},
+		},
+		{
+			name:     "hive restriction shadowed",
+			fields:   map[string]string{"kind": "hive-restriction", "variable": "JAVA_HOME", "hive": "HKLM", "within": `C:\Program Files`},
+			expected: []string{`error: JAVA_HOME[0] (HKLM): C:\jdk: entry outside C:\Program Files [hive-restriction-1]`},
+		},
+		{
+			name:     "hive restriction defined",
+			fields:   map[string]string{"kind": "hive-restriction", "variable": "*_HOME", "hive": "hkcu"},
+			expected: []string{"error: JAVA_HOME: defined in HKCU [hive-restriction-1]", "error: M2_HOME: defined in HKCU [hive-restriction-1]"},
+		},
+	}
+	env := lintEnv(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := ruleFields{fields: map[string]ruleField{}, line: 1}
+			for key, value := range tt.fields {
+				item.fields[key] = ruleField{value: value, line: 1}
+			}
+			rule, err := newLintRule(item, 0)
+			if err != nil {
+				t.Fatalf("newLintRule() error = %v", err)
+			}
+			var got []string
+			for _, f := range rule.check(env, env.Expander()) {
+				got = append(got, f.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("check() =\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.expected, "\n"))
+			}
+		})
+	}
+}
+
+func TestLintRule_MaxLengthUTF16(t *testing.T) {
+	user := envreg.NewMemSource(envreg.HKCU)
+	user.Set("EMOJI", "hi 👋", envreg.REG_SZ)           // 4 characters, 5 UTF-16 code units, 7 bytes
+	user.Set("GREETING", "héllo wörld", envreg.REG_SZ) // 11 characters, 13 bytes
+	env, err := envreg.Read(context.Background(), envreg.Options{System: envreg.NewMemSource(envreg.HKLM), User: user})
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := ruleFields{fields: map[string]ruleField{
+		"kind":     {value: "max-length", line: 1},
+		"variable": {value: "*", line: 1},
+		"max":      {value: "5", line: 1},
+	}, line: 1}
+	rule, err := newLintRule(item, 0)
+	if err != nil {
+		t.Fatalf("newLintRule() error = %v", err)
+	}
+	var got []string
+	for _, f := range rule.check(env, env.Expander()) {
+		got = append(got, f.String())
+	}
+	expected := []string{"error: GREETING: length 11 exceeds 5 characters [max-length-1]"}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("check() =\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestNewLintRule_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		fields   map[string]string
+		expected string
+	}{
+		{name: "kind", fields: map[string]string{"variable": "X"}, expected: "line 1: missing kind"},
+		{name: "unknown kind", fields: map[string]string{"kind": "banned", "variable": "X"}, expected: `line 2: unknown rule kind "banned"`},
+		{name: "variable", fields: map[string]string{"kind": "required"}, expected: "line 1: missing variable"},
+		{name: "severity", fields: map[string]string{"kind": "required", "variable": "X", "severity": "fatal"}, expected: `line 2: unknown severity "fatal", expected one of error, warning, note`},
+		{name: "unknown key", fields: map[string]string{"kind": "required", "variable": "X", "max": "3"}, expected: `line 2: unknown key "max" for rule kind required`},
+		{name: "hive", fields: map[string]string{"kind": "required", "variable": "X", "hive": "HKCR"}, expected: `line 2: hive: unknown hive "HKCR", expected HKLM or HKCU`},
+		{name: "max", fields: map[string]string{"kind": "max-length", "variable": "X", "max": "-1"}, expected: "line 2: max: max must be a positive number"},
+		{name: "missing before", fields: map[string]string{"kind": "path-order", "variable": "X", "after": "a"}, expected: "line 1: missing before for rule kind path-order"},
+		{name: "pattern", fields: map[string]string{"kind": "pattern", "variable": "X", "pattern": "("}, expected: "line 2: pattern: error parsing regexp: missing closing ): `(`"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := ruleFields{fields: map[string]ruleField{}, line: 1}
+			for key, value := range tt.fields {
+				item.fields[key] = ruleField{value: value, line: 2}
+			}
+			_, err := newLintRule(item, 0)
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("newLintRule() error = %v, want %q", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRunLint(t *testing.T) {
+	rules := filepath.Join(t.TempDir(), "rules.yaml")
+	content := `rules:
+  - id: no-dot
+    kind: forbidden
+    variable: Path
+    entry: '.'
+  - id: m2
+    kind: required
+    variable: M2_HOME
+    severity: warning
+`
+	if err := os.WriteFile(rules, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	system := envreg.NewMemSource(envreg.HKLM)
+	system.Set("Path", `C:\Windows;.`, envreg.REG_SZ)
+	user := envreg.NewMemSource(envreg.HKCU)
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format:   "text",
+			expected: "error: Path[1] (HKLM): .: forbidden entry [no-dot]\nwarning: M2_HOME: required variable is not defined [m2]\n",
+		},
+		{
+			format: "json",
+			expected: `[
+  {
+    "rule": "no-dot",
+    "kind": "forbidden",
+    "severity": "error",
+    "variable": "Path",
+    "index": 1,
+    "entry": ".",
+    "hive": "HKLM",
+    "message": "forbidden entry"
+  },
+  {
+    "rule": "m2",
+    "kind": "required",
+    "severity": "warning",
+    "variable": "M2_HOME",
+    "message": "required variable is not defined"
+  }
+]
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			p := &peekenv{opts: envreg.Options{System: system, User: user}}
+			var buf bytes.Buffer
+			found, err := runLint(&Config{rules: rules, format: tt.format}, p, nil, &buf)
+			if err != nil {
+				t.Fatalf("runLint() error = %v", err)
+			}
+			if !found || buf.String() != tt.expected {
+				t.Errorf("runLint() = %v,\n%s\nwant:\n%s", found, buf.String(), tt.expected)
+			}
+		})
+	}
+
+	t.Run("sarif", func(t *testing.T) {
+		p := &peekenv{opts: envreg.Options{System: system, User: user}}
+		var buf bytes.Buffer
+		if _, err := runLint(&Config{rules: rules, format: "sarif"}, p, nil, &buf); err != nil {
+			t.Fatalf("runLint() error = %v", err)
+		}
+		var log sarifLog
+		if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+			t.Fatalf("invalid SARIF: %v", err)
+		}
+		run := log.Runs[0]
+		if log.Version != "2.1.0" || len(run.Tool.Driver.Rules) != 2 || len(run.Results) != 2 {
+			t.Fatalf("unexpected SARIF log: %s", buf.String())
+		}
+		result := run.Results[0]
+		location := result.Locations[0].LogicalLocations[0]
+		if result.RuleID != "no-dot" || result.Level != "error" || location.FullyQualifiedName != `HKLM\Path[1]` {
+			t.Errorf("unexpected SARIF result: %+v", result)
+		}
+		if result := run.Results[1]; result.RuleIndex != 1 || result.Level != "warning" {
+			t.Errorf("unexpected SARIF result: %+v", result)
+		}
+	})
+
+	t.Run("format", func(t *testing.T) {
+		p := &peekenv{opts: envreg.Options{System: system, User: user}}
+		if _, err := runLint(&Config{rules: rules, format: "reg"}, p, nil, &bytes.Buffer{}); err == nil {
+			t.Error("runLint() expected error for the reg format")
+		}
+	})
+}
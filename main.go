@@ -1,12 +1,17 @@
-//go:build windows
-
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tischda/peekenv/v3/envreg"
 )
 
 // https://goreleaser.com/cookbooks/using-main.version/
@@ -17,15 +22,76 @@ var (
 	commit  string
 )
 
+// exit codes, other errors exit with code 1
+const (
+	exitFindings = 3 // a command such as diff reports differences
+	exitMissing  = 4 // requested variables are not found in strict mode
+)
+
+// commands are the names of the commands, all other arguments are variable names.
+var commands = []string{"diff", "check", "grep", "snapshot", "history", "exec", "watch", "lint"}
+
 // flags
 type Config struct {
-	user    bool
-	machine bool
-	header  bool
-	expand  bool
-	output  string
-	help    bool
-	version bool
+	user       bool
+	machine    bool
+	header     bool
+	expand     bool
+	processEnv bool
+	types      bool
+	provenance bool
+	strict     bool
+	merge      string
+	mergeOrder string
+	separator  string
+	format     string
+	pathStyle  string
+	exclude    stringList
+	regFiles   stringList
+	hiveSystem string
+	hiveUser   string
+	store      string
+	interval   time.Duration
+	rules      string
+	output     string
+	help       bool
+	version    bool
+}
+
+// stringList is a flag that can be repeated to specify several values, eg. files.
+type stringList []string
+
+// String returns the values separated by commas.
+func (f *stringList) String() string {
+	return strings.Join(*f, ",")
+}
+
+// Set adds a value to the list.
+func (f *stringList) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// mode returns the registry keys to read from, based on the user and machine flags.
+func (cfg *Config) mode() envreg.Mode {
+	if cfg.machine && cfg.user {
+		return envreg.Both
+	} else if cfg.machine {
+		return envreg.Machine
+	} else if cfg.user {
+		return envreg.User
+	}
+	return envreg.Both
+}
+
+// formatOptions returns the options of the output formats.
+func (cfg *Config) formatOptions() envreg.FormatOptions {
+	return envreg.FormatOptions{
+		Header:     cfg.header,
+		Types:      cfg.types,
+		Provenance: cfg.provenance,
+		PathStyle:  cfg.pathStyle,
+	}
 }
 
 func initFlags() *Config {
@@ -38,6 +104,24 @@ func initFlags() *Config {
 	flag.BoolVar(&cfg.header, "header", false, "print info header")
 	flag.BoolVar(&cfg.expand, "x", false, "")
 	flag.BoolVar(&cfg.expand, "expand", false, "expand environment variables to values (eg. %APPDATA%)")
+	flag.BoolVar(&cfg.processEnv, "process-env", false, "expand references to variables that are not in the registry from the process environment")
+	flag.BoolVar(&cfg.types, "t", false, "")
+	flag.BoolVar(&cfg.types, "types", false, "print registry value types in section headers")
+	flag.BoolVar(&cfg.provenance, "p", false, "")
+	flag.BoolVar(&cfg.provenance, "provenance", false, "annotate variables and path entries with the hive they were read from")
+	flag.BoolVar(&cfg.strict, "strict", false, "report requested variables that are not found and exit with code 4")
+	flag.StringVar(&cfg.merge, "merge", strings.Join(envreg.PathVariables, ","), "variables concatenated when defined in both hives")
+	flag.StringVar(&cfg.mergeOrder, "merge-order", "system", "order of merged values: system or user first")
+	flag.StringVar(&cfg.separator, "separator", ";", "separator between the entries of merged variables")
+	flag.StringVar(&cfg.format, "format", "text", "output format: text, json, reg, ps1, sh, fish or dotenv")
+	flag.StringVar(&cfg.pathStyle, "path-style", "windows", "translation of C:\\ paths in sh and fish formats: windows, wsl or msys")
+	flag.Var(&cfg.exclude, "exclude", "skip the variables matching a name or pattern (repeatable)")
+	flag.Var(&cfg.regFiles, "reg", "read variables from a .reg file instead of the registry (repeatable)")
+	flag.StringVar(&cfg.hiveSystem, "hive-system", "", "read system variables from an offline SYSTEM hive file")
+	flag.StringVar(&cfg.hiveUser, "hive-user", "", "read user variables from an offline NTUSER.DAT hive file")
+	flag.StringVar(&cfg.store, "store", defaultStoreDir(), "directory of the snapshot store")
+	flag.DurationVar(&cfg.interval, "interval", 2*time.Second, "polling interval of watch when change notifications are not available")
+	flag.StringVar(&cfg.rules, "rules", "", "rules file checked by lint")
 	flag.StringVar(&cfg.output, "o", "stdout", "")
 	flag.StringVar(&cfg.output, "output", "stdout", "file to dump the environment variables to")
 	flag.BoolVar(&cfg.help, "?", false, "")
@@ -52,11 +136,73 @@ func main() {
 	cfg := initFlags()
 	flag.Usage = func() {
 		fmt.Fprintln(os.Stderr, "Usage: "+name+` [OPTIONS] [variables...]
+       `+name+` diff [OPTIONS] FILE1 [FILE2]
+       `+name+` check [OPTIONS] [variables...]
+       `+name+` grep [OPTIONS] PATTERN [variables...]
+       `+name+` snapshot [OPTIONS] [variables...]
+       `+name+` history [OPTIONS] [NAME]
+       `+name+` exec [OPTIONS] -- COMMAND [args...]
+       `+name+` watch [OPTIONS] [variables...]
+       `+name+` lint [OPTIONS] --rules FILE
 
 Retrieves environment variables from the Windows registry. By default,
 both system and user variables are read. You can filter using OPTIONS.
 
 If no variables are specified, all environment variables are printed.
+Variables can be selected by name (case-insensitive), by glob pattern (eg.
+JAVA_* or *_HOME) or by regular expression prefixed with re: (eg.
+re:^VS\d+COMNTOOLS$). A warning is printed for each name or pattern that
+matches no variable.
+
+COMMANDS:
+
+  diff FILE1 [FILE2]
+          compare two exports in the section format or .env files, or an export
+          with the registry, and print added (+), removed (-) and changed (~)
+          variables. Path entries are compared one by one. Exits with code 3
+          when the environments differ.
+
+  check [variables...]
+          check the entries of merged variables (or of the specified variables)
+          for duplicates, empty entries, unterminated quotes, unresolved %VAR%
+          references and directories that do not exist, and the length of the
+          values against the Windows limit. Exits with code 3 when problems are
+          found.
+
+  grep PATTERN [variables...]
+          search the values of all variables (or of the specified variables)
+          and the entries of merged variables for PATTERN, ignoring case, or
+          for a regular expression prefixed with re:. Prints the matches as
+          NAME[index]: entry, with the hive they were read from. System values
+          shadowed by user values are also searched.
+
+  snapshot [variables...]
+          save the variables (or the specified variables) with their types and
+          hives, the time, host and user to a new snapshot in the store.
+
+  history [NAME]
+          list the snapshots of the store, or show how the variable NAME
+          changed across the snapshots, with the differences to the previous
+          snapshot like diff.
+
+  exec -- COMMAND [args...]
+          run COMMAND with the environment a new logon session would get: the
+          registry variables, expanded, and the Volatile Environment of the
+          user (eg. USERPROFILE), over the environment of peekenv. COMMAND is
+          searched in the new Path. Exits with the exit code of COMMAND.
+
+  watch [variables...]
+          watch the Environment keys and print the differences like diff each
+          time variables (or the specified variables) are added, removed or
+          changed, until interrupted with Ctrl+C. With --format json, prints
+          one JSON object per changed variable (JSON lines).
+
+  lint --rules FILE
+          check the variables against the rules of FILE, a YAML file with a
+          list of rules of the kinds required, forbidden, pattern, path-order,
+          max-length and hive-restriction, and print the violations. With
+          --format json or sarif, prints a JSON or SARIF report. Exits with
+          code 3 when rules with severity error are violated.
 
 OPTIONS:
 
@@ -68,6 +214,56 @@ OPTIONS:
           print info header
   -x, --expand
           expand environment variables to values (eg. %APPDATA%)
+  --process-env
+          expand references to variables that are not in the registry, like
+          %SystemRoot%, from the environment of peekenv. Each of them is
+          reported on stderr.
+  -t, --types
+          print registry value types in section headers (eg. [Path] REG_EXPAND_SZ)
+  -p, --provenance
+          annotate variables and path entries with the hive they were read from
+          (HKLM or HKCU), and show system values shadowed by user values
+  --strict
+          report each requested variable that is not found as an error and
+          exit with code 4, so that scripts can test whether variables exist
+  --merge LIST
+          comma separated names or patterns (eg. *_PATH) of the variables whose
+          system and user values are concatenated, '!' excludes a variable from
+          a previous pattern (default: Path,PsModulePath). Other user variables
+          override system variables.
+  --merge-order ORDER
+          order of merged values: system (default) or user first
+  --separator SEP
+          separator between the entries of merged variables, inserted between
+          the system and user values and used to split them into entries
+          (default: ;)
+  --format FORMAT
+          output format: text (default), json, reg (Windows .reg file), ps1
+          (PowerShell script setting the variables), sh (POSIX shell exports),
+          fish or dotenv (.env file)
+  --exclude PATTERN
+          skip the variables matching a name, glob pattern or re: regular
+          expression, in all sources. Can be repeated.
+  --path-style STYLE
+          translation of paths like C:\foo in the sh and fish formats: windows
+          (default, unchanged), wsl (/mnt/c/foo) or msys (/c/foo, Git Bash).
+          Lists of paths are translated only in merged variables.
+  --reg FILE
+          read the variables from a .reg file exported by regedit instead of
+          the registry. Can be repeated, later files override earlier ones.
+  --hive-system FILE
+          read the system variables from an offline SYSTEM hive file (eg. of
+          a mounted disk image) instead of the registry
+  --hive-user FILE
+          read the user variables from an offline NTUSER.DAT hive file
+  --store DIR
+          directory of the snapshots saved by snapshot and read by history
+          (default: %AppData%\peekenv\snapshots)
+  --interval DURATION
+          how often watch reads the environment when the registry cannot
+          notify changes, eg. 500ms (default: 2s)
+  --rules FILE
+          rules file checked by lint
   -o, --output FILE
           file to dump the environment variables to (default: stdout)
   -?, --help
@@ -75,11 +271,24 @@ OPTIONS:
   -v, --version
           print version and exit
 
+EXIT STATUS:
+
+  0       success
+  1       error, eg. a file or the registry cannot be read
+  3       diff found differences, check found problems, or lint found errors
+  4       requested variables were not found (with --strict)
+  *       exec exits with the exit code of the command
+
 EXAMPLES:`)
 
 		fmt.Fprintln(os.Stderr, "\n  $ "+name+` TEMP
   [TEMP]
-  c:\temp`)
+  c:\temp
+
+  $ `+name+` -o before.txt
+  $ `+name+` diff before.txt
+  ~ Path
+      + [12] C:\Program Files\Git\cmd`)
 	}
 	flag.Parse()
 
@@ -93,13 +302,131 @@ EXAMPLES:`)
 		return
 	}
 
+	// Options may also follow the command name, eg. "diff -u FILE"
+	command, args := "", flag.Args()
+	if slices.Contains(commands, flag.Arg(0)) {
+		command, args = flag.Arg(0), subcommandArgs()
+	}
+
+	policy, err := envreg.NewMergePolicy(cfg.merge, cfg.mergeOrder, cfg.separator)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	system, user, offline, err := openSources(cfg)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	// Process the environment variables
 	peekenv := peekenv{
-		envMap:    make(map[string]string),
-		variables: flag.Args(),
+		opts: envreg.Options{
+			Variables: args,
+			Exclude:   cfg.exclude,
+			System:    system,
+			User:      user,
+			Merge:     policy,
+		},
+		strict: cfg.strict,
+	}
+	if cfg.processEnv {
+		// variables like SystemRoot or USERPROFILE are not in the Environment keys
+		peekenv.opts.LookupEnv = peekenv.lookupProcessEnv
 	}
 
-	if err := peekenv.exportEnv(cfg); err != nil {
+	var found bool
+	var exitCode int
+	switch command {
+	case "diff":
+		found, err = runDiff(cfg, &peekenv, args, os.Stdout)
+	case "check":
+		found, err = runCheck(cfg, &peekenv, os.Stdout, osFS{})
+	case "grep":
+		err = runGrep(cfg, &peekenv, args, os.Stdout)
+	case "snapshot":
+		err = runSnapshot(cfg, &peekenv, os.Stdout)
+	case "history":
+		err = runHistory(cfg, &peekenv, args, os.Stdout)
+	case "exec":
+		volatile := envreg.NewVolatileSource()
+		if offline {
+			volatile = envreg.NewMemSource(envreg.HKCU)
+		}
+		exitCode, err = runExec(cfg, &peekenv, volatile, args)
+	case "lint":
+		found, err = runLint(cfg, &peekenv, args, os.Stdout)
+	case "watch":
+		if offline {
+			err = fmt.Errorf("watch reads the registry, it cannot be combined with --reg, --hive-system or --hive-user")
+			break
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		err = runWatch(ctx, cfg, &peekenv, os.Stdout)
+		stop()
+	default:
+		err = peekenv.exportEnv(cfg)
+	}
+	if err != nil {
 		log.Fatalln(err)
 	}
+	peekenv.warnUnreadable()
+	peekenv.reportProcessEnv()
+	if peekenv.reportUnmatched() {
+		os.Exit(exitMissing)
+	}
+	if found {
+		os.Exit(exitFindings)
+	}
+	if exitCode != 0 {
+		os.Exit(exitCode)
+	}
+}
+
+// subcommandArgs parses the options following a command name, so that they can
+// be given before or after the command (eg. "diff -u FILE"), and returns the
+// remaining arguments.
+func subcommandArgs() []string {
+	_ = flag.CommandLine.Parse(flag.Args()[1:]) // exits on error
+	return flag.Args()
+}
+
+// openSources returns the sources of the system and user variables: the .reg or
+// hive files specified on the command line, or the live registry. A hive that
+// has no file is empty when reading files.
+//
+// Parameters:
+//   - cfg: the runtime configuration specifying the files to read
+//
+// Returns the system and user sources, true if they do not read the live registry
+// (so that the process environment does not belong to them), or an error if a file
+// cannot be read.
+func openSources(cfg *Config) (envreg.Source, envreg.Source, bool, error) {
+	hiveFiles := cfg.hiveSystem != "" || cfg.hiveUser != ""
+	switch {
+	case len(cfg.regFiles) > 0 && hiveFiles:
+		return nil, nil, true, fmt.Errorf("--reg cannot be combined with --hive-system or --hive-user")
+	case len(cfg.regFiles) > 0:
+		system, user := envreg.NewMemSource(envreg.HKLM), envreg.NewMemSource(envreg.HKCU)
+		for _, path := range cfg.regFiles {
+			if err := envreg.LoadRegFile(path, system, user); err != nil {
+				return nil, nil, true, err
+			}
+		}
+		return system, user, true, nil
+	case hiveFiles:
+		system, user := envreg.NewMemSource(envreg.HKLM), envreg.NewMemSource(envreg.HKCU)
+		var err error
+		if cfg.hiveSystem != "" {
+			if system, err = envreg.LoadHiveFile(cfg.hiveSystem, envreg.HKLM); err != nil {
+				return nil, nil, true, err
+			}
+		}
+		if cfg.hiveUser != "" {
+			if user, err = envreg.LoadHiveFile(cfg.hiveUser, envreg.HKCU); err != nil {
+				return nil, nil, true, err
+			}
+		}
+		return system, user, true, nil
+	}
+	return envreg.NewRegistrySource(envreg.HKLM), envreg.NewRegistrySource(envreg.HKCU), false, nil
 }
@@ -1,11 +1,12 @@
-//go:build windows
-
 package main
 
 import (
 	"flag"
 	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/tischda/peekenv/v3/envreg"
 )
 
 func TestInitFlags(t *testing.T) {
@@ -37,6 +38,42 @@ func TestInitFlags(t *testing.T) {
 	if cfg.expand != false {
 		t.Errorf("Expected expand default to be false, got %v", cfg.expand)
 	}
+	if cfg.types != false {
+		t.Errorf("Expected types default to be false, got %v", cfg.types)
+	}
+	if cfg.provenance != false {
+		t.Errorf("Expected provenance default to be false, got %v", cfg.provenance)
+	}
+	if cfg.merge != "Path,PsModulePath" {
+		t.Errorf("Expected merge default to be 'Path,PsModulePath', got %v", cfg.merge)
+	}
+	if cfg.mergeOrder != "system" {
+		t.Errorf("Expected merge-order default to be 'system', got %v", cfg.mergeOrder)
+	}
+	if cfg.separator != ";" {
+		t.Errorf("Expected separator default to be ';', got %v", cfg.separator)
+	}
+	if cfg.format != "text" {
+		t.Errorf("Expected format default to be 'text', got %v", cfg.format)
+	}
+	if cfg.pathStyle != "windows" {
+		t.Errorf("Expected path-style default to be 'windows', got %v", cfg.pathStyle)
+	}
+	if cfg.strict != false {
+		t.Errorf("Expected strict default to be false, got %v", cfg.strict)
+	}
+	if len(cfg.exclude) != 0 {
+		t.Errorf("Expected exclude default to be empty, got %v", cfg.exclude)
+	}
+	if len(cfg.regFiles) != 0 {
+		t.Errorf("Expected reg default to be empty, got %v", cfg.regFiles)
+	}
+	if cfg.hiveSystem != "" || cfg.hiveUser != "" {
+		t.Errorf("Expected hive files default to be empty, got %q and %q", cfg.hiveSystem, cfg.hiveUser)
+	}
+	if cfg.store != defaultStoreDir() {
+		t.Errorf("Expected store default to be %q, got %q", defaultStoreDir(), cfg.store)
+	}
 	if cfg.output != "stdout" {
 		t.Errorf("Expected output default to be 'stdout', got %v", cfg.output)
 	}
@@ -54,6 +91,18 @@ func TestInitFlags(t *testing.T) {
 		"-m",
 		"-h",
 		"-x",
+		"-t",
+		"-p",
+		"--strict",
+		"--format", "json",
+		"--path-style", "wsl",
+		"--exclude", "JAVA_*",
+		"--exclude", "re:^TMP$",
+		"--reg", "a.reg",
+		"--reg", "b.reg",
+		"--hive-system", "SYSTEM",
+		"--hive-user", "NTUSER.DAT",
+		"--store", "snapshots",
 		"-o", "test.txt",
 		"-v",
 	}
@@ -81,6 +130,36 @@ func TestInitFlags(t *testing.T) {
 	if !cfg.expand {
 		t.Error("Expected expand flag to be true")
 	}
+	if !cfg.types {
+		t.Error("Expected types flag to be true")
+	}
+	if !cfg.provenance {
+		t.Error("Expected provenance flag to be true")
+	}
+	if !cfg.strict {
+		t.Error("Expected strict flag to be true")
+	}
+	if cfg.format != "json" {
+		t.Errorf("Expected format to be 'json', got %v", cfg.format)
+	}
+	if cfg.pathStyle != "wsl" {
+		t.Errorf("Expected path-style to be 'wsl', got %v", cfg.pathStyle)
+	}
+	if cfg.exclude.String() != "JAVA_*,re:^TMP$" {
+		t.Errorf("Expected exclude to be 'JAVA_*,re:^TMP$', got %v", cfg.exclude)
+	}
+	if cfg.regFiles.String() != "a.reg,b.reg" {
+		t.Errorf("Expected reg to be 'a.reg,b.reg', got %v", cfg.regFiles)
+	}
+	if cfg.hiveSystem != "SYSTEM" {
+		t.Errorf("Expected hive-system to be 'SYSTEM', got %v", cfg.hiveSystem)
+	}
+	if cfg.hiveUser != "NTUSER.DAT" {
+		t.Errorf("Expected hive-user to be 'NTUSER.DAT', got %v", cfg.hiveUser)
+	}
+	if cfg.store != "snapshots" {
+		t.Errorf("Expected store to be 'snapshots', got %v", cfg.store)
+	}
 	if cfg.output != "test.txt" {
 		t.Errorf("Expected output to be 'test.txt', got %v", cfg.output)
 	}
@@ -88,3 +167,32 @@ func TestInitFlags(t *testing.T) {
 		t.Error("Expected version flag to be true")
 	}
 }
+
+func TestOpenSources_Conflict(t *testing.T) {
+	cfg := &Config{regFiles: stringList{"a.reg"}, hiveUser: "NTUSER.DAT"}
+	if _, _, _, err := openSources(cfg); err == nil {
+		t.Error("openSources() expected error when combining --reg and --hive-user")
+	}
+}
+
+func TestOpenSources_RegFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "env.reg")
+	data := "Windows Registry Editor Version 5.00\n[HKEY_CURRENT_USER\\Environment]\n\"TEMP\"=\"C:\\\\Temp\"\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	system, user, offline, err := openSources(&Config{regFiles: stringList{path}})
+	if err != nil {
+		t.Fatalf("openSources() error = %v", err)
+	}
+	if !offline {
+		t.Error("openSources() offline = false, want true for .reg files")
+	}
+	p := &peekenv{opts: envreg.Options{System: system, User: user}}
+	if err := p.read(envreg.Both, false); err != nil {
+		t.Fatalf("read() error = %v", err)
+	}
+	if got := p.env.Variables["TEMP"].Value; got != `C:\Temp` {
+		t.Errorf("TEMP = %q, want %q", got, `C:\Temp`)
+	}
+}
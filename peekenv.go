@@ -1,41 +1,28 @@
-//go:build windows
-
 package main
 
 import (
+	"context"
 	"fmt"
-	"io"
+	"log"
+	"maps"
 	"os"
-	"sort"
+	"slices"
 	"strings"
-	"time"
-
-	"golang.org/x/sys/windows/registry"
-)
-
-// RegistryMode represents which registry keys to read from
-type RegistryMode int
-
-const (
-	MACHINE RegistryMode = iota // Read only from HKEY_LOCAL_MACHINE
-	USER                        // Read only from HKEY_CURRENT_USER
-	BOTH                        // Read from both registries, user takes precedence
-)
 
-var (
-	// Header strings for different registry modes
-	headerStrings = map[RegistryMode]string{
-		USER:    "# HKEY_CURRENT_USER\\Environment\n",
-		MACHINE: "# HKEY_LOCAL_MACHINE\\SYSTEM\\CurrentControlSet\\Control\\Session Manager\\Environment\n",
-		BOTH:    "# HKEY_LOCAL_MACHINE\\SYSTEM\\CurrentControlSet\\Control\\Session Manager\\Environment\n# HKEY_CURRENT_USER\\Environment\n",
-	}
+	"github.com/tischda/peekenv/v3/envreg"
 )
 
-// peekenv handles the reading and formatting of environment variables.
-// It maintains a map of environment variables, and which variables to export (if specified).
+// peekenv handles the reading and formatting of environment variables for the
+// command line. It keeps the options used to read the environment with envreg,
+// the environment read, and the problems reported on stderr.
 type peekenv struct {
-	envMap    map[string]string
-	variables []string
+	opts        envreg.Options      // sources, variables, merge policy and expansion fallback
+	env         *envreg.Environment // the variables read
+	strict      bool                // report the requested variables that are not found as errors
+	unmatched   []string            // names and patterns that matched no variable
+	missing     []string            // requested variables not found, in strict mode
+	unreadable  []error             // values that could not be read, reported as warnings
+	fromProcess map[string]bool     // upper-case names of the variables resolved from the process environment
 }
 
 // exportEnv reads environment variables from the registry and writes them to the output.
@@ -44,70 +31,55 @@ type peekenv struct {
 //   - cfg: the runtime configuration specifying registry mode, output options, etc.
 //
 // Returns an error if reading from registry fails or no environment variables are found.
+// In strict mode, nothing is written when only missing variables were requested.
 func (p *peekenv) exportEnv(cfg *Config) error {
-
-	mode := BOTH
-	if cfg.machine && cfg.user {
-		mode = BOTH
-	} else if cfg.machine {
-		mode = MACHINE
-	} else if cfg.user {
-		mode = USER
+	if err := envreg.CheckFormat(cfg.format, cfg.formatOptions()); err != nil {
+		return err
 	}
-
-	if err := p.readRegistry(mode); err != nil {
+	if err := p.read(cfg.mode(), cfg.expand); err != nil {
 		return err
 	}
-
-	// Expand variables if requested
-	if cfg.expand {
-		for k, v := range p.envMap {
-			p.envMap[k] = expandVariable(v)
-		}
+	// in strict mode, an existing output file is kept when nothing matches
+	if len(p.env.Variables) == 0 && len(p.missing) > 0 {
+		return nil
 	}
-	return p.writeOutput(cfg, mode)
+	return p.writeOutput(cfg)
 }
 
-// readRegistry reads environment variables from the Windows registry based on the specified mode.
+// read reads the environment variables selected by p.opts from the registry.
 //
 // Parameters:
-//   - mode: specifies which registry keys to read from (USER, MACHINE, or BOTH)
-//
-// Returns an error if registry access fails or no environment variables are found.
-func (p *peekenv) readRegistry(mode RegistryMode) error {
-	switch mode {
-	case USER:
-		if err := p.getUserVariables(false); err != nil {
-			return fmt.Errorf("reading user environment variables: %w", err)
-		}
-	case MACHINE:
-		if err := p.getSystemVariables(); err != nil {
-			return fmt.Errorf("reading system environment variables: %w", err)
-		}
-	default:
-		// order matters, first system, then user (so user can override)
-		if err := p.getSystemVariables(); err != nil {
-			return fmt.Errorf("reading system environment variables: %w", err)
-		}
-		if err := p.getUserVariables(true); err != nil {
-			return fmt.Errorf("reading user environment variables: %w", err)
-		}
+//   - mode: specifies which registry keys to read from
+//   - expand: if true, %VAR% references are expanded
+//
+// Returns an error if registry access fails, a pattern is invalid, or no environment
+// variables are found (except for requested variables in strict mode).
+func (p *peekenv) read(mode envreg.Mode, expand bool) error {
+	opts := p.opts
+	opts.Mode = mode
+	opts.Expand = expand
+	// in strict mode, the missing variables are reported by name instead
+	opts.AllowEmpty = p.strict
+	env, err := envreg.Read(context.Background(), opts)
+	if err != nil {
+		return err
 	}
-
-	if len(p.envMap) == 0 {
-		return fmt.Errorf("no environment variables found")
+	p.env = env
+	p.unmatched = env.Unmatched
+	if p.strict {
+		p.missing = env.Missing
 	}
+	p.unreadable = env.Unreadable
 	return nil
 }
 
 // writeOutput writes the formatted environment variables to the specified output.
 //
 // Parameters:
-//   - cfg: the runtime configuration containing output file path and header options
-//   - mode: the registry mode used for header generation
+//   - cfg: the runtime configuration containing output file path and format options
 //
-// Returns an error if file creation, header writing, or variable writing fails.
-func (p *peekenv) writeOutput(cfg *Config, mode RegistryMode) error {
+// Returns an error if file creation, formatting or writing fails.
+func (p *peekenv) writeOutput(cfg *Config) error {
 
 	// Open output file or use stdout
 	var err error
@@ -120,129 +92,51 @@ func (p *peekenv) writeOutput(cfg *Config, mode RegistryMode) error {
 			return fmt.Errorf("creating output file: %w", err)
 		}
 	}
-	defer file.Close()  //nolint:errcheck
-
-	// Print header if requested
-	if cfg.header {
-		header := headerStrings[mode]
-		now := time.Now().Format("2006-01-02 15:04:05 -0700 MST")
-		header += fmt.Sprintf("# Exported on %s\n\n", now)
-		_, err := io.WriteString(file, header)
-		if err != nil {
-			return fmt.Errorf("writing header: %w", err)
-		}
-	}
+	defer file.Close() //nolint:errcheck
 
-	// Print variables in proper format
-	_, err = io.WriteString(file, p.String())
-	return err
+	return envreg.Write(file, p.env, cfg.format, cfg.formatOptions())
 }
 
-// getSystemVariables opens the HKEY_LOCAL_MACHINE registry key and populates
-// p.envMap with system variables.
-//
-// Returns an error if the registry cannot be accessed or read.
-func (p *peekenv) getSystemVariables() error {
-	sysReg, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control\Session Manager\Environment`, registry.READ)
-	if err == nil {
-		defer sysReg.Close()  //nolint:errcheck
-		err = p.getVariables(sysReg, false)
-	}
-	return err
-}
-
-// getUserVariables opens the HKEY_CURRENT_USER registry key and populates
-// p.envMap with user variables
-//
-// Parameters:
-//   - mergePaths: if true, merges "Path" and "PsModulePath" with existing values in p.envMap
-//
-// Returns an error if the registry cannot be accessed or read.
-func (p *peekenv) getUserVariables(mergePaths bool) error {
-	userReg, err := registry.OpenKey(registry.CURRENT_USER, `Environment`, registry.READ)
-	if err == nil {
-		defer userReg.Close()  //nolint:errcheck
-		err = p.getVariables(userReg, mergePaths)
+// warnUnreadable prints a warning on stderr for each value that could not be read.
+func (p *peekenv) warnUnreadable() {
+	for _, err := range p.unreadable {
+		log.Println("warning:", err)
 	}
-	return err
 }
 
-// getVariables reads environment variables from the provided registry key.
-//
-// Parameters:
-//   - reg: the registry key to read variables from
-//   - mergePaths: if true, merges "Path" and "PsModulePath" with existing values in p.envMap
-//
-// Merging presupposes that p.envMap has already been initialized with SYSTEM variables.
-// Therefore, call getSystemVariables() before calling this with mergePaths=true.
-//
-// Returns an error if the registry values cannot be read.
-func (p *peekenv) getVariables(reg registry.Key, mergePaths bool) error {
-	env, err := reg.ReadValueNames(0)
-	for _, variable := range env {
-		if len(p.variables) > 0 && !containsIgnoreCase(p.variables, variable) {
-			continue
-		}
-		val, _, _ := reg.GetStringValue(variable)
-		if mergePaths && (variable == "Path" || variable == "PsModulePath") {
-			// Append USER Path to SYSTEM Path (system first, then user)
-			p.envMap[variable] = p.envMap[variable] + ";" + val
-		} else {
-			p.envMap[variable] = val
+// lookupProcessEnv returns the value of a variable of the process environment,
+// and records its name so that the values not read from the registry are reported.
+func (p *peekenv) lookupProcessEnv(name string) (string, bool) {
+	value, ok := os.LookupEnv(name)
+	if ok {
+		if p.fromProcess == nil {
+			p.fromProcess = make(map[string]bool)
 		}
+		p.fromProcess[strings.ToUpper(name)] = true
 	}
-	return err
+	return value, ok
 }
 
-// String returns string representation of all variables, formatted like this:
-//
-// [M2_HOME]
-// c:\usr\bin\maven
-
-// [Path]
-// c:\Windows\system32
-// c:\Windows
-//
-// Path type variables with multiple values separated by semicolons will be printed separated by
-// newlines for better readability. This is also the format expected when importing with pokenv.
-func (p *peekenv) String() string {
-	var sb strings.Builder
-
-	// Sort keys for consistent alphabetical output (case-insensitive)
-	keyMap := make(map[string]string)
-	keys := make([]string, 0, len(p.envMap))
-	for k := range p.envMap {
-		keys = append(keys, strings.ToLower(k))
-		keyMap[strings.ToLower(k)] = k
+// reportProcessEnv prints a warning on stderr for each variable resolved from the
+// process environment instead of the registry, in alphabetical order.
+func (p *peekenv) reportProcessEnv() {
+	for _, name := range slices.Sorted(maps.Keys(p.fromProcess)) {
+		log.Printf("warning: %%%s%% expanded from the process environment", name)
 	}
-	sort.Strings(keys)
-
-	// Format output with a section header for each variable
-	for i, k := range keys {
-		if i > 0 {
-			sb.WriteString("\n\n")
-		}
-		originalKey := keyMap[k]
-		sb.WriteString("[" + originalKey + "]\n")
-		sb.WriteString(strings.ReplaceAll(p.envMap[originalKey], ";", "\n"))
-	}
-	sb.WriteString("\n")
-	return sb.String()
 }
 
-// containsIgnoreCase checks if a string slice contains a target string using
-// case-insensitive comparison.
+// reportUnmatched prints a message on stderr for each variable name or pattern
+// that matched no variable: an error for the requested variables in strict mode,
+// a warning otherwise.
 //
-// Parameters:
-//   - slice: the string slice to search in
-//   - str: the target string to search for
-//
-// Returns true if the target string is found (case-insensitive), false otherwise.
-func containsIgnoreCase(slice []string, str string) bool {
-	for _, item := range slice {
-		if strings.EqualFold(item, str) {
-			return true
+// Returns true if requested variables are missing in strict mode.
+func (p *peekenv) reportUnmatched() bool {
+	for _, pattern := range p.unmatched {
+		if slices.Contains(p.missing, pattern) {
+			log.Printf("error: variable not found: %s", pattern)
+		} else {
+			log.Printf("warning: no variable matches %s", pattern)
 		}
 	}
-	return false
+	return len(p.missing) > 0
 }
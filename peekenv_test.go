@@ -1,266 +1,199 @@
 package main
 
 import (
+	"bytes"
+	"log"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/tischda/peekenv/v3/envreg"
+	"github.com/tischda/peekenv/v3/envreg/envregtest"
 )
 
-func TestPeekenv_String(t *testing.T) {
+// fixtureSources returns in-memory system and user sources with typical values.
+func fixtureSources() (*envreg.MemSource, *envreg.MemSource) {
+	system, user := envreg.NewMemSource(envreg.HKLM), envreg.NewMemSource(envreg.HKCU)
+	envregtest.Fill(system, user)
+	return system, user
+}
+
+func TestPeekenv_ReportUnmatched(t *testing.T) {
 	tests := []struct {
 		name     string
-		envMap   map[string]string
+		strict   bool
+		missing  bool
 		expected string
 	}{
 		{
-			name: "single variable",
-			envMap: map[string]string{
-				"TEMP": "C:\\Temp",
-			},
-			expected: "[TEMP]\nC:\\Temp\n",
-		},
-		{
-			name: "multiple variables",
-			envMap: map[string]string{
-				"TEMP": "C:\\Temp",
-				"USER": "johndoe",
-			},
-			expected: "[TEMP]\nC:\\Temp\n\n[USER]\njohndoe\n",
+			name:     "warnings",
+			expected: "warning: no variable matches BAR\nwarning: no variable matches re:^GO\n",
 		},
 		{
-			name: "Path variable with semicolons",
-			envMap: map[string]string{
-				"Path": "C:\\Windows\\System32;C:\\Windows;C:\\Program Files\\Git\\bin",
-			},
-			expected: "[Path]\nC:\\Windows\\System32\nC:\\Windows\nC:\\Program Files\\Git\\bin\n",
-		},
-		{
-			name: "Path and other variables",
-			envMap: map[string]string{
-				"Path": "C:\\Windows;C:\\Program Files",
-				"TEMP": "C:\\Temp",
-			},
-			expected: "[Path]\nC:\\Windows\nC:\\Program Files\n\n[TEMP]\nC:\\Temp\n",
+			name:     "strict",
+			strict:   true,
+			missing:  true,
+			expected: "error: variable not found: BAR\nwarning: no variable matches re:^GO\n",
 		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			flags := log.Flags()
+			log.SetOutput(&buf)
+			log.SetFlags(0)
+			t.Cleanup(func() {
+				log.SetOutput(os.Stderr)
+				log.SetFlags(flags)
+			})
+
+			system, user := fixtureSources()
+			p := &peekenv{
+				opts: envreg.Options{
+					Variables: []string{"os", "BAR"},
+					Exclude:   []string{"re:^GO"},
+					System:    system,
+					User:      user,
+				},
+				strict: tt.strict,
+			}
+			if err := p.read(envreg.Both, false); err != nil {
+				t.Fatalf("read() error = %v", err)
+			}
+			if got := p.reportUnmatched(); got != tt.missing {
+				t.Errorf("reportUnmatched() = %v, want %v", got, tt.missing)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("reportUnmatched() printed %q, want %q", buf.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestPeekenv_ProcessEnv(t *testing.T) {
+	t.Setenv("SystemRoot", `C:\Windows`)
+	tests := []struct {
+		name     string
+		process  bool
+		value    string
+		expected string
+	}{
 		{
-			name:     "empty map",
-			envMap:   map[string]string{},
-			expected: "\n",
+			name:  "registry only",
+			value: `%SystemRoot%\TEMP`,
 		},
 		{
-			name: "variable with empty value",
-			envMap: map[string]string{
-				"EMPTY": "",
-			},
-			expected: "[EMPTY]\n\n",
+			name:     "process env",
+			process:  true,
+			value:    `C:\Windows\TEMP`,
+			expected: "warning: %SYSTEMROOT% expanded from the process environment\n",
 		},
 	}
-
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			flags := log.Flags()
+			log.SetOutput(&buf)
+			log.SetFlags(0)
+			t.Cleanup(func() {
+				log.SetOutput(os.Stderr)
+				log.SetFlags(flags)
+			})
+
+			system, user := fixtureSources()
 			p := &peekenv{
-				envMap: tt.envMap,
+				opts: envreg.Options{
+					Variables: []string{"TEMP"},
+					System:    system,
+					User:      user,
+				},
 			}
-			result := p.String()
-
-			// For tests with multiple variables, we need to handle the fact that
-			// map iteration order is not guaranteed in Go
-			if len(tt.envMap) > 1 && !strings.Contains(tt.name, "Path") {
-				// Check that all expected sections are present
-				for key, value := range tt.envMap {
-					expectedSection := "[" + key + "]\n" + value
-					if !strings.Contains(result, expectedSection) {
-						t.Errorf("String() = %q, missing section for %s", result, key)
-					}
-				}
-				// Check that result ends with newline
-				if !strings.HasSuffix(result, "\n") {
-					t.Errorf("String() = %q, should end with newline", result)
-				}
-			} else {
-				// For single variable or Path tests, we can do exact comparison
-				if result != tt.expected {
-					t.Errorf("String() = %q, want %q", result, tt.expected)
-				}
+			if tt.process {
+				p.opts.LookupEnv = p.lookupProcessEnv
+			}
+			if err := p.read(envreg.Machine, true); err != nil {
+				t.Fatalf("read() error = %v", err)
+			}
+			if got := p.env.Variables["TEMP"].Value; got != tt.value {
+				t.Errorf("TEMP = %q, want %q", got, tt.value)
+			}
+			p.reportProcessEnv()
+			if buf.String() != tt.expected {
+				t.Errorf("reportProcessEnv() printed %q, want %q", buf.String(), tt.expected)
 			}
 		})
 	}
 }
 
-func TestPeekenv_ExportEnv_Both(t *testing.T) {
-	// Create a temporary file for output
-	tmpFile, err := os.CreateTemp("", "peekenv_test_both_*.txt")
-	if err != nil {
-		t.Fatalf("Failed to create temporary file: %v", err)
-	}
-	defer os.Remove(tmpFile.Name()) // Will run after Close() due to LIFO
-	defer tmpFile.Close()           // Will run first, ensuring file is closed before removal
-
-	// Create a peekenv instance that will read from real registry
+func TestPeekenv_ExportEnv_Fixture(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.txt")
+	system, user := fixtureSources()
 	p := &peekenv{
-		envMap:    make(map[string]string),
-		variables: []string{}, // No filters, read all variables
+		opts: envreg.Options{
+			Variables: []string{"Path", "OS"},
+			System:    system,
+			User:      user,
+		},
 	}
-
 	cfg := &Config{
-		output: tmpFile.Name(),
+		format: "text",
+		output: out,
 		header: true,
-		expand: false,
 	}
 
-	// Execute the test with real registry reading
-	err = p.exportEnv(cfg)
-
-	if err != nil {
+	if err := p.exportEnv(cfg); err != nil {
 		t.Fatalf("exportEnv() error = %v", err)
 	}
-
-	// Read the output from the temporary file
-	content, err := os.ReadFile(tmpFile.Name())
+	content, err := os.ReadFile(out)
 	if err != nil {
-		t.Fatalf("Failed to read temporary file: %v", err)
+		t.Fatalf("Failed to read output file: %v", err)
 	}
 	output := string(content)
 
-	// Check for expected header content
-	expectedHeaders := []string{
-		"# HKEY_LOCAL_MACHINE\\SYSTEM\\CurrentControlSet\\Control\\Session Manager\\Environment",
-		"# HKEY_CURRENT_USER\\Environment",
-		"# Exported on",
-	}
-
-	for _, expected := range expectedHeaders {
-		if !strings.Contains(output, expected) {
-			t.Errorf("Output should contain header %q, but got:\n%s", expected, output)
-		}
+	if !strings.HasPrefix(output, "# HKEY_LOCAL_MACHINE\\SYSTEM\\CurrentControlSet\\Control\\Session Manager\\Environment\n# HKEY_CURRENT_USER\\Environment\n# Exported on ") {
+		t.Errorf("Output should start with BOTH header, got:\n%s", output)
 	}
-
-	// Verify that PATH variable exists and contains expected Windows system paths
-	if !strings.Contains(output, "[Path]") {
-		t.Error("Output should contain [Path] section")
-	}
-
-	// Check for typical Windows system paths that should be in PATH
-	expectedSystemPaths := []string{
-		"Windows\\System32",
-		"Windows",
-	}
-
-	for _, expectedPath := range expectedSystemPaths {
-		if !strings.Contains(output, expectedPath) {
-			t.Errorf("PATH should contain system path %q", expectedPath)
-		}
-	}
-
-	// Check for typical user PATH entry (WindowsApps is commonly in user PATH)
-	if !strings.Contains(output, "WindowsApps") {
-		t.Log("WindowsApps not found in PATH - this may be normal depending on system configuration")
-	}
-
-	// Verify that OS variable exists and contains Windows_NT
-	if !strings.Contains(output, "[OS]") {
-		t.Error("Output should contain [OS] section")
-	}
-
-	if !strings.Contains(output, "Windows_NT") {
-		t.Error("OS variable should contain Windows_NT")
-	}
-
-	// Verify output format - should have sections with proper formatting
-	lines := strings.Split(output, "\n")
-	foundOSSection := false
-	foundPathSection := false
-
-	for _, line := range lines {
-		if line == "[OS]" {
-			foundOSSection = true
-		}
-		if line == "[Path]" {
-			foundPathSection = true
-		}
-	}
-
-	if !foundOSSection {
-		t.Error("Should have properly formatted [OS] section")
-	}
-
-	if !foundPathSection {
-		t.Error("Should have properly formatted [Path] section")
+	expected := "[OS]\nWindows_NT\n\n[Path]\n%SystemRoot%\\system32\n%SystemRoot%\n%USERPROFILE%\\AppData\\Local\\Microsoft\\WindowsApps\n"
+	if !strings.HasSuffix(output, "\n\n"+expected) {
+		t.Errorf("Output = %q, want suffix %q", output, expected)
 	}
 }
 
-func TestPeekenv_ExportEnv_Machine_Expand_Windir(t *testing.T) {
-	// Create a temporary file for output
-	tmpFile, err := os.CreateTemp("", "peekenv_test_*.txt")
-	if err != nil {
-		t.Fatalf("Failed to create temporary file: %v", err)
+func TestPeekenv_ExportEnv_StrictMissing(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "env.txt")
+	if err := os.WriteFile(out, []byte("[FOO]\nbar\n"), 0o644); err != nil {
+		t.Fatal(err)
 	}
-	defer os.Remove(tmpFile.Name()) // Will run after Close() due to LIFO
-	defer tmpFile.Close()           // Will run first, ensuring file is closed before removal
-
-	// Create a peekenv instance that will read from real registry
+	system, user := fixtureSources()
 	p := &peekenv{
-		envMap:    make(map[string]string),
-		variables: []string{"windir"}, // Filter for only windir variable
+		opts:   envreg.Options{Variables: []string{"FOO"}, System: system, User: user},
+		strict: true,
 	}
 
-	cfg := &Config{
-		machine: true, // Read only machine variables
-		output:  tmpFile.Name(),
-		header:  false, // No header for cleaner output
-		expand:  true,  // Expand environment variables
-	}
-
-	// Execute the test with machine registry reading only
-	err = p.exportEnv(cfg)
-
-	if err != nil {
+	if err := p.exportEnv(&Config{format: "text", output: out}); err != nil {
 		t.Fatalf("exportEnv() error = %v", err)
 	}
-
-	// Read the output from the temporary file
-	content, err := os.ReadFile(tmpFile.Name())
-	if err != nil {
-		t.Fatalf("Failed to read temporary file: %v", err)
-	}
-	output := string(content)
-
-	// Verify that windir variable exists and is properly formatted
-	if !strings.Contains(output, "[windir]") {
-		t.Error("Output should contain [windir] section")
+	if !reflect.DeepEqual(p.missing, []string{"FOO"}) {
+		t.Errorf("missing = %v, want [FOO]", p.missing)
 	}
-
-	// Check that the expanded value contains Windows directory path
-	expectedPaths := []string{
-		"C:\\WINDOWS",
-		"C:\\Windows", // Alternative casing
-	}
-
-	foundExpectedPath := false
-	for _, expectedPath := range expectedPaths {
-		if strings.Contains(output, expectedPath) {
-			foundExpectedPath = true
-			break
-		}
-	}
-
-	if !foundExpectedPath {
-		t.Errorf("windir should contain Windows directory path, got output:\n%s", output)
+	content, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
 	}
-
-	// Verify the output format matches expected structure
-	lines := strings.Split(strings.TrimSpace(output), "\n")
-	if len(lines) < 2 {
-		t.Errorf("Output should have at least 2 lines (section header + value), got %d lines", len(lines))
+	if string(content) != "[FOO]\nbar\n" {
+		t.Errorf("output file was overwritten: %q", content)
 	}
+}
 
-	// First line should be the section header
-	if lines[0] != "[windir]" {
-		t.Errorf("First line should be [windir], got %q", lines[0])
+func TestPeekenv_ExportEnv_UnknownFormat(t *testing.T) {
+	system, user := fixtureSources()
+	p := &peekenv{opts: envreg.Options{System: system, User: user}}
+	if err := p.exportEnv(&Config{format: "xml", output: "stdout"}); err == nil {
+		t.Error("exportEnv() should fail for unknown format")
 	}
-
-	// Second line should contain the Windows path
-	if !strings.Contains(strings.ToUpper(lines[1]), "WINDOWS") {
-		t.Errorf("Second line should contain Windows path, got %q", lines[1])
+	if err := p.exportEnv(&Config{format: "sh", pathStyle: "cygwin", output: "stdout"}); err == nil {
+		t.Error("exportEnv() should fail for unknown path style")
 	}
 }
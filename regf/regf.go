@@ -0,0 +1,379 @@
+// Package regf reads offline Windows registry hive files, such as the SYSTEM
+// hive and NTUSER.DAT of a mounted disk image, without the Windows API.
+//
+// A hive file starts with a 4096 bytes base block, followed by hive bins
+// containing cells. Cells hold key nodes (nk), values (vk), subkey and value
+// lists, and value data. Only what is needed to read keys and values is
+// supported: transaction logs are not replayed, so a hive that was not cleanly
+// unloaded may miss the latest changes.
+package regf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+// ErrNotFound is returned when a key or value does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Sizes and offsets of the hive file format.
+const (
+	baseBlockSize    = 4096  // hive bins start after the base block
+	rootCellOffset   = 0x24  // offset of the root key cell in the base block
+	bigDataThreshold = 16344 // data larger than this is split in segments (db record)
+	maxListDepth     = 2     // an index root (ri) points to lists of subkeys
+	keyCompName      = 0x20  // key name flag: name is ASCII instead of UTF-16LE
+	valueCompName    = 0x01  // value name flag: name is ASCII instead of UTF-16LE
+	dataInline       = 0x80000000
+)
+
+// Hive is a registry hive file loaded in memory.
+type Hive struct {
+	data []byte
+	root uint32
+}
+
+// Key is a registry key of a hive.
+type Key struct {
+	hive *Hive
+	name string
+	nk   []byte // key node record
+}
+
+// Value is a registry value with its raw data, strings are in UTF-16LE.
+type Value struct {
+	Name string
+	Type uint32
+	Data []byte
+}
+
+// Open reads a hive file.
+//
+// Parameters:
+//   - path: the name of the hive file, eg. C:\Windows\System32\config\SYSTEM
+//
+// Returns an error if the file cannot be read or is not a hive file.
+func Open(path string) (*Hive, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return h, nil
+}
+
+// Parse returns the hive contained in data, which must start with the base block.
+func Parse(data []byte) (*Hive, error) {
+	if len(data) < baseBlockSize || !bytes.HasPrefix(data, []byte("regf")) {
+		return nil, errors.New("not a registry hive file")
+	}
+	h := &Hive{data: data, root: binary.LittleEndian.Uint32(data[rootCellOffset:])}
+	if _, err := h.Root(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Root returns the root key of the hive.
+func (h *Hive) Root() (*Key, error) {
+	return h.key(h.root)
+}
+
+// cell returns the data of the cell at offset, relative to the first hive bin.
+func (h *Hive) cell(offset uint32) ([]byte, error) {
+	start := uint64(baseBlockSize) + uint64(offset)
+	if start+4 > uint64(len(h.data)) {
+		return nil, fmt.Errorf("cell offset 0x%x out of range", offset)
+	}
+	size := int64(int32(binary.LittleEndian.Uint32(h.data[start:])))
+	if size < 0 {
+		size = -size // allocated cells have a negative size
+	}
+	if size < 4 || start+uint64(size) > uint64(len(h.data)) {
+		return nil, fmt.Errorf("invalid cell size %d at offset 0x%x", size, offset)
+	}
+	return h.data[start+4 : start+uint64(size)], nil
+}
+
+// record returns the cell at offset, checking its signature and minimum size.
+func (h *Hive) record(offset uint32, minSize int, signatures ...string) ([]byte, error) {
+	c, err := h.cell(offset)
+	if err != nil {
+		return nil, err
+	}
+	if len(c) < max(minSize, 2) {
+		return nil, fmt.Errorf("truncated record at offset 0x%x", offset)
+	}
+	for _, sig := range signatures {
+		if string(c[:2]) == sig {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected record %q at offset 0x%x, expected %s", c[:2], offset, strings.Join(signatures, " or "))
+}
+
+// key returns the key whose key node record is at offset.
+func (h *Hive) key(offset uint32) (*Key, error) {
+	nk, err := h.record(offset, 0x4c, "nk")
+	if err != nil {
+		return nil, err
+	}
+	nameLen := int(binary.LittleEndian.Uint16(nk[0x48:]))
+	if 0x4c+nameLen > len(nk) {
+		return nil, fmt.Errorf("truncated key name at offset 0x%x", offset)
+	}
+	name := nk[0x4c : 0x4c+nameLen]
+	k := &Key{hive: h, nk: nk}
+	if binary.LittleEndian.Uint16(nk[0x02:])&keyCompName != 0 {
+		k.name = latin1(name)
+	} else {
+		k.name = utf16String(name)
+	}
+	return k, nil
+}
+
+// Name returns the name of the key.
+func (k *Key) Name() string {
+	return k.name
+}
+
+// Subkeys returns the subkeys of the key.
+func (k *Key) Subkeys() ([]*Key, error) {
+	count := binary.LittleEndian.Uint32(k.nk[0x14:])
+	if count == 0 {
+		return nil, nil
+	}
+	offsets, err := k.hive.subkeyOffsets(binary.LittleEndian.Uint32(k.nk[0x1c:]), maxListDepth, int(count))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", k.name, err)
+	}
+	keys := make([]*Key, 0, len(offsets))
+	for _, offset := range offsets {
+		sub, err := k.hive.key(offset)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k.name, err)
+		}
+		keys = append(keys, sub)
+	}
+	return keys, nil
+}
+
+// subkeyOffsets returns the offsets of the key nodes of a subkey list, which
+// must not contain more than limit subkeys.
+func (h *Hive) subkeyOffsets(offset uint32, depth, limit int) ([]uint32, error) {
+	list, err := h.record(offset, 4, "lf", "lh", "li", "ri")
+	if err != nil {
+		return nil, err
+	}
+	sig := string(list[:2])
+	count := int(binary.LittleEndian.Uint16(list[2:]))
+	stride := 4 // li and ri: offsets only
+	if sig == "lf" || sig == "lh" {
+		stride = 8 // offset and name hash
+	}
+	if 4+count*stride > len(list) {
+		return nil, fmt.Errorf("truncated %s list at offset 0x%x", sig, offset)
+	}
+
+	var offsets []uint32
+	for i := range count {
+		o := binary.LittleEndian.Uint32(list[4+i*stride:])
+		if sig != "ri" {
+			offsets = append(offsets, o)
+			continue
+		}
+		if depth <= 1 {
+			return nil, fmt.Errorf("nested index root at offset 0x%x", offset)
+		}
+		sub, err := h.subkeyOffsets(o, depth-1, limit-len(offsets))
+		if err != nil {
+			return nil, err
+		}
+		offsets = append(offsets, sub...)
+	}
+	if len(offsets) > limit {
+		return nil, fmt.Errorf("%s list at offset 0x%x exceeds the subkey count", sig, offset)
+	}
+	return offsets, nil
+}
+
+// Subkey returns the key at path, relative to k. Path elements are separated
+// by backslashes and matched case-insensitively, like in the registry.
+//
+// Returns an error wrapping ErrNotFound if the key does not exist.
+func (k *Key) Subkey(path string) (*Key, error) {
+	current := k
+	for _, name := range strings.Split(path, `\`) {
+		if name == "" {
+			continue
+		}
+		subkeys, err := current.Subkeys()
+		if err != nil {
+			return nil, err
+		}
+		var next *Key
+		for _, sub := range subkeys {
+			if strings.EqualFold(sub.name, name) {
+				next = sub
+				break
+			}
+		}
+		if next == nil {
+			return nil, fmt.Errorf("key %s: %w", path, ErrNotFound)
+		}
+		current = next
+	}
+	return current, nil
+}
+
+// Values returns the values of the key, in the order they are stored.
+func (k *Key) Values() ([]Value, error) {
+	count := int(binary.LittleEndian.Uint32(k.nk[0x24:]))
+	if count == 0 {
+		return nil, nil
+	}
+	list, err := k.hive.cell(binary.LittleEndian.Uint32(k.nk[0x28:]))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", k.name, err)
+	}
+	if count*4 > len(list) {
+		return nil, fmt.Errorf("%s: truncated value list", k.name)
+	}
+
+	values := make([]Value, 0, count)
+	for i := range count {
+		v, err := k.hive.value(binary.LittleEndian.Uint32(list[i*4:]))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k.name, err)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// Value returns the named value of the key, matched case-insensitively.
+// The default value of the key has an empty name.
+//
+// Returns an error wrapping ErrNotFound if the value does not exist.
+func (k *Key) Value(name string) (Value, error) {
+	values, err := k.Values()
+	if err != nil {
+		return Value{}, err
+	}
+	for _, v := range values {
+		if strings.EqualFold(v.Name, name) {
+			return v, nil
+		}
+	}
+	return Value{}, fmt.Errorf("value %s\\%s: %w", k.name, name, ErrNotFound)
+}
+
+// value returns the value whose value key record is at offset.
+func (h *Hive) value(offset uint32) (Value, error) {
+	vk, err := h.record(offset, 0x14, "vk")
+	if err != nil {
+		return Value{}, err
+	}
+	nameLen := int(binary.LittleEndian.Uint16(vk[0x02:]))
+	if 0x14+nameLen > len(vk) {
+		return Value{}, fmt.Errorf("truncated value name at offset 0x%x", offset)
+	}
+	v := Value{Type: binary.LittleEndian.Uint32(vk[0x0c:])}
+	if binary.LittleEndian.Uint16(vk[0x10:])&valueCompName != 0 {
+		v.Name = latin1(vk[0x14 : 0x14+nameLen])
+	} else {
+		v.Name = utf16String(vk[0x14 : 0x14+nameLen])
+	}
+
+	size := binary.LittleEndian.Uint32(vk[0x04:])
+	dataOffset := binary.LittleEndian.Uint32(vk[0x08:])
+	switch {
+	case size&dataInline != 0:
+		// small values are stored in the data offset field
+		size &^= dataInline
+		if size > 4 {
+			return Value{}, fmt.Errorf("value %s: invalid inline data size %d", v.Name, size)
+		}
+		v.Data = vk[0x08 : 0x08+size]
+	case size > bigDataThreshold:
+		v.Data, err = h.bigData(dataOffset, size)
+	case size > 0:
+		var c []byte
+		c, err = h.cell(dataOffset)
+		if err == nil && int(size) > len(c) {
+			err = fmt.Errorf("truncated data at offset 0x%x", dataOffset)
+		}
+		if err == nil {
+			v.Data = c[:size]
+		}
+	}
+	if err != nil {
+		return Value{}, fmt.Errorf("value %s: %w", v.Name, err)
+	}
+	return v, nil
+}
+
+// bigData returns the data of a value stored in segments (db record).
+func (h *Hive) bigData(offset, size uint32) ([]byte, error) {
+	db, err := h.record(offset, 8, "db")
+	if err != nil {
+		// hives older than version 1.4 store big values in a single cell
+		c, cellErr := h.cell(offset)
+		if cellErr != nil || int(size) > len(c) {
+			return nil, err
+		}
+		return c[:size], nil
+	}
+	if int64(size) > int64(len(h.data)) {
+		// the segments are stored in the hive, a larger size is corrupted
+		return nil, fmt.Errorf("invalid big data size %d at offset 0x%x", size, offset)
+	}
+	count := int(binary.LittleEndian.Uint16(db[2:]))
+	segments, err := h.cell(binary.LittleEndian.Uint32(db[4:]))
+	if err != nil {
+		return nil, err
+	}
+	if count*4 > len(segments) || int(size) > count*bigDataThreshold {
+		return nil, fmt.Errorf("truncated big data at offset 0x%x", offset)
+	}
+
+	data := make([]byte, 0, size)
+	for i := range count {
+		segment, err := h.cell(binary.LittleEndian.Uint32(segments[i*4:]))
+		if err != nil {
+			return nil, err
+		}
+		n := min(len(segment), bigDataThreshold, int(size)-len(data))
+		data = append(data, segment[:n]...)
+	}
+	if len(data) < int(size) {
+		return nil, fmt.Errorf("truncated big data at offset 0x%x", offset)
+	}
+	return data, nil
+}
+
+// latin1 converts a name stored with one byte per character.
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// utf16String converts a name stored in UTF-16LE.
+func utf16String(b []byte) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,235 @@
+package regf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/tischda/peekenv/v3/regf/regftest"
+)
+
+// sampleHive returns a SYSTEM-like hive using every kind of subkey list.
+func sampleHive() []byte {
+	return regftest.Build(&regftest.Key{
+		Name: "ROOT",
+		List: "ri",
+		Subkeys: []*regftest.Key{
+			{
+				Name: "ControlSet001",
+				List: "li",
+				Subkeys: []*regftest.Key{{
+					Name: "Control",
+					List: "lf",
+					Subkeys: []*regftest.Key{{
+						Name:      "Session Manager",
+						WideNames: true,
+						Subkeys: []*regftest.Key{{
+							Name: "Environment",
+							Values: []regftest.Value{
+								{Name: "OS", Type: 1, Data: regftest.String("Windows_NT")},
+								{Name: "NUMBER_OF_PROCESSORS", Type: 4, Data: regftest.Dword(16)},
+							},
+						}},
+					}},
+				}},
+			},
+			{
+				Name: "Select",
+				Values: []regftest.Value{
+					{Name: "Current", Type: 4, Data: regftest.Dword(1)},
+				},
+			},
+		},
+	})
+}
+
+func TestParse(t *testing.T) {
+	h, err := Parse(sampleHive())
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	root, err := h.Root()
+	if err != nil {
+		t.Fatalf("Root() error = %v", err)
+	}
+	if root.Name() != "ROOT" {
+		t.Errorf("Root().Name() = %q, want ROOT", root.Name())
+	}
+
+	subkeys, err := root.Subkeys()
+	if err != nil {
+		t.Fatalf("Subkeys() error = %v", err)
+	}
+	var names []string
+	for _, k := range subkeys {
+		names = append(names, k.Name())
+	}
+	if !reflect.DeepEqual(names, []string{"ControlSet001", "Select"}) {
+		t.Errorf("Subkeys() = %v", names)
+	}
+
+	env, err := root.Subkey(`controlset001\Control\SESSION MANAGER\Environment`)
+	if err != nil {
+		t.Fatalf("Subkey() error = %v", err)
+	}
+	values, err := env.Values()
+	if err != nil {
+		t.Fatalf("Values() error = %v", err)
+	}
+	expected := []Value{
+		{Name: "OS", Type: 1, Data: regftest.String("Windows_NT")},
+		{Name: "NUMBER_OF_PROCESSORS", Type: 4, Data: regftest.Dword(16)},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Values() = %v, want %v", values, expected)
+	}
+}
+
+func TestKey_Value(t *testing.T) {
+	h, err := Parse(sampleHive())
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	root, _ := h.Root()
+	sel, err := root.Subkey("Select")
+	if err != nil {
+		t.Fatalf("Subkey() error = %v", err)
+	}
+	v, err := sel.Value("current")
+	if err != nil {
+		t.Fatalf("Value() error = %v", err)
+	}
+	if !bytes.Equal(v.Data, regftest.Dword(1)) {
+		t.Errorf("Value() data = %v, want 1", v.Data)
+	}
+
+	if _, err := sel.Value("Missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Value() error = %v, want ErrNotFound", err)
+	}
+	if _, err := root.Subkey(`ControlSet002\Control`); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Subkey() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestKey_Values_BigData(t *testing.T) {
+	path := regftest.String(strings.Repeat(`C:\Tools;`, 2000)) // more than one segment
+	h, err := Parse(regftest.Build(&regftest.Key{
+		Name:      "ROOT",
+		WideNames: true,
+		Values: []regftest.Value{
+			{Name: "Path", Type: 2, Data: path},
+			{Name: "Empty", Type: 1},
+		},
+	}))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	root, _ := h.Root()
+	values, err := root.Values()
+	if err != nil {
+		t.Fatalf("Values() error = %v", err)
+	}
+	if len(values) != 2 || values[0].Name != "Path" || !bytes.Equal(values[0].Data, path) {
+		t.Errorf("Values() big data mismatch, got %d values", len(values))
+	}
+	if values[1].Name != "Empty" || len(values[1].Data) != 0 {
+		t.Errorf("Values() empty value = %+v", values[1])
+	}
+}
+
+func TestHive_BigData_HugeSize(t *testing.T) {
+	// a db record with 0xffff segments, whose list is a cell of zero offsets
+	dbSize, segmentsSize := int32(16), int32(4+0xffff*4)
+	data := make([]byte, baseBlockSize+dbSize+segmentsSize)
+	bin := data[baseBlockSize:]
+	binary.LittleEndian.PutUint32(bin, uint32(-dbSize)) // allocated cells have a negative size
+	copy(bin[4:], "db")
+	binary.LittleEndian.PutUint16(bin[6:], 0xffff)
+	binary.LittleEndian.PutUint32(bin[8:], uint32(dbSize))
+	binary.LittleEndian.PutUint32(bin[dbSize:], uint32(-segmentsSize))
+	h := &Hive{data: data}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := h.bigData(0, 0xffff*bigDataThreshold)
+	runtime.ReadMemStats(&after)
+	if err == nil || !strings.Contains(err.Error(), "invalid big data size") {
+		t.Errorf("bigData() error = %v, want invalid big data size", err)
+	}
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("bigData() allocated %d bytes", n)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	valid := sampleHive()
+	truncated := valid[:len(valid)-4096]
+	badRoot := bytes.Clone(valid)
+	copy(badRoot[0x24:], []byte{0xff, 0xff, 0xff, 0x00})
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"not a hive", bytes.Repeat([]byte("x"), 8192)},
+		{"truncated", truncated},
+		{"root out of range", badRoot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.data); err == nil {
+				t.Error("Parse() expected error")
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "SYSTEM")
+	if err := os.WriteFile(path, sampleHive(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err != nil {
+		t.Errorf("Open() error = %v", err)
+	}
+	if _, err := Open(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Open() expected error for missing file")
+	}
+}
+
+// FuzzParse checks that corrupted hives return errors instead of panicking.
+func FuzzParse(f *testing.F) {
+	f.Add(sampleHive())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		h, err := Parse(data)
+		if err != nil {
+			return
+		}
+		root, err := h.Root()
+		if err != nil {
+			return
+		}
+		budget := 1000
+		walk(root, &budget)
+	})
+}
+
+// walk reads the keys and values below k, up to budget keys: corrupted
+// subkey lists may point back to their parent.
+func walk(k *Key, budget *int) {
+	if *budget--; *budget < 0 {
+		return
+	}
+	_, _ = k.Values()
+	subkeys, _ := k.Subkeys()
+	for _, sub := range subkeys {
+		walk(sub, budget)
+	}
+}
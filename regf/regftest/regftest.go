@@ -0,0 +1,199 @@
+// Package regftest builds registry hive files for tests, so that offline hives
+// can be read without real SYSTEM or NTUSER.DAT files.
+package regftest
+
+import (
+	"encoding/binary"
+	"unicode/utf16"
+)
+
+// Key is a registry key to write in a hive.
+type Key struct {
+	Name      string
+	Values    []Value
+	Subkeys   []*Key
+	List      string // subkey list record: "lh" (default), "lf", "li" or "ri"
+	WideNames bool   // store key and value names in UTF-16LE instead of ASCII
+}
+
+// Value is a registry value to write in a hive. Strings must be UTF-16LE.
+type Value struct {
+	Name string
+	Type uint32
+	Data []byte
+}
+
+// String returns a null-terminated UTF-16LE string, as stored in REG_SZ values.
+func String(s string) []byte {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, c)
+	}
+	return append(b, 0, 0)
+}
+
+// Dword returns a REG_DWORD value.
+func Dword(n uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, n)
+}
+
+// Sizes of the hive file format.
+const (
+	baseBlockSize = 4096
+	binHeaderSize = 32
+	maxSegment    = 16344
+)
+
+// builder appends cells to a hive bin.
+type builder struct {
+	bin []byte
+}
+
+// Build returns a hive file containing root and its subkeys.
+func Build(root *Key) []byte {
+	b := &builder{bin: make([]byte, binHeaderSize)}
+	copy(b.bin, "hbin")
+	rootOffset := b.key(root)
+
+	// a single hive bin, aligned to 4096 bytes
+	size := (len(b.bin) + 4095) &^ 4095
+	b.bin = append(b.bin, make([]byte, size-len(b.bin))...)
+	binary.LittleEndian.PutUint32(b.bin[8:], uint32(size))
+
+	base := make([]byte, baseBlockSize)
+	copy(base, "regf")
+	binary.LittleEndian.PutUint32(base[0x14:], 1) // major version
+	binary.LittleEndian.PutUint32(base[0x18:], 5) // minor version
+	binary.LittleEndian.PutUint32(base[0x24:], rootOffset)
+	binary.LittleEndian.PutUint32(base[0x28:], uint32(size))
+	return append(base, b.bin...)
+}
+
+// cell appends an allocated cell and returns its offset.
+func (b *builder) cell(data []byte) uint32 {
+	offset := uint32(len(b.bin))
+	size := (len(data) + 4 + 7) &^ 7
+	b.bin = binary.LittleEndian.AppendUint32(b.bin, uint32(-int32(size)))
+	b.bin = append(b.bin, data...)
+	b.bin = append(b.bin, make([]byte, size-4-len(data))...)
+	return offset
+}
+
+// key appends the key node of k, its values and subkeys, and returns its offset.
+func (b *builder) key(k *Key) uint32 {
+	var subkeys []uint32
+	for _, sub := range k.Subkeys {
+		subkeys = append(subkeys, b.key(sub))
+	}
+	var values []uint32
+	for _, v := range k.Values {
+		values = append(values, b.value(v, k.WideNames))
+	}
+
+	name, flags := []byte(k.Name), uint16(0x20)
+	if k.WideNames {
+		name, flags = String(k.Name), 0
+		name = name[:len(name)-2]
+	}
+	nk := make([]byte, 0x4c)
+	copy(nk, "nk")
+	binary.LittleEndian.PutUint16(nk[0x02:], flags)
+	binary.LittleEndian.PutUint32(nk[0x14:], uint32(len(subkeys)))
+	binary.LittleEndian.PutUint32(nk[0x1c:], 0xffffffff)
+	binary.LittleEndian.PutUint32(nk[0x24:], uint32(len(values)))
+	binary.LittleEndian.PutUint32(nk[0x28:], 0xffffffff)
+	binary.LittleEndian.PutUint16(nk[0x48:], uint16(len(name)))
+	if len(subkeys) > 0 {
+		binary.LittleEndian.PutUint32(nk[0x1c:], b.list(k.List, subkeys))
+	}
+	if len(values) > 0 {
+		binary.LittleEndian.PutUint32(nk[0x28:], b.offsets(values))
+	}
+	return b.cell(append(nk, name...))
+}
+
+// list appends a subkey list of the specified type and returns its offset.
+func (b *builder) list(sig string, offsets []uint32) uint32 {
+	switch sig {
+	case "li":
+		data := []byte("li")
+		data = binary.LittleEndian.AppendUint16(data, uint16(len(offsets)))
+		for _, o := range offsets {
+			data = binary.LittleEndian.AppendUint32(data, o)
+		}
+		return b.cell(data)
+	case "ri":
+		// one list per subkey, referenced by the index root
+		var lists []uint32
+		for _, o := range offsets {
+			lists = append(lists, b.list("lh", []uint32{o}))
+		}
+		data := []byte("ri")
+		data = binary.LittleEndian.AppendUint16(data, uint16(len(lists)))
+		for _, o := range lists {
+			data = binary.LittleEndian.AppendUint32(data, o)
+		}
+		return b.cell(data)
+	case "":
+		sig = "lh"
+	}
+	data := []byte(sig)
+	data = binary.LittleEndian.AppendUint16(data, uint16(len(offsets)))
+	for _, o := range offsets {
+		data = binary.LittleEndian.AppendUint32(data, o)
+		data = binary.LittleEndian.AppendUint32(data, 0) // name hash, not checked by readers
+	}
+	return b.cell(data)
+}
+
+// offsets appends a cell containing a list of offsets and returns its offset.
+func (b *builder) offsets(offsets []uint32) uint32 {
+	var data []byte
+	for _, o := range offsets {
+		data = binary.LittleEndian.AppendUint32(data, o)
+	}
+	return b.cell(data)
+}
+
+// value appends the value key of v and its data, and returns its offset.
+func (b *builder) value(v Value, wide bool) uint32 {
+	name, flags := []byte(v.Name), uint16(1)
+	if wide {
+		name, flags = String(v.Name), 0
+		name = name[:len(name)-2]
+	}
+	vk := make([]byte, 0x14)
+	copy(vk, "vk")
+	binary.LittleEndian.PutUint16(vk[0x02:], uint16(len(name)))
+	binary.LittleEndian.PutUint32(vk[0x0c:], v.Type)
+	binary.LittleEndian.PutUint16(vk[0x10:], flags)
+
+	size := uint32(len(v.Data))
+	switch {
+	case size <= 4:
+		// small values are stored in the data offset field
+		binary.LittleEndian.PutUint32(vk[0x04:], size|0x80000000)
+		copy(vk[0x08:], v.Data)
+	case size > maxSegment:
+		binary.LittleEndian.PutUint32(vk[0x04:], size)
+		binary.LittleEndian.PutUint32(vk[0x08:], b.bigData(v.Data))
+	default:
+		binary.LittleEndian.PutUint32(vk[0x04:], size)
+		binary.LittleEndian.PutUint32(vk[0x08:], b.cell(v.Data))
+	}
+	return b.cell(append(vk, name...))
+}
+
+// bigData appends the segments of a big value and its db record, and returns its offset.
+func (b *builder) bigData(data []byte) uint32 {
+	var segments []uint32
+	for len(data) > 0 {
+		n := min(len(data), maxSegment)
+		segments = append(segments, b.cell(data[:n]))
+		data = data[n:]
+	}
+	db := []byte("db")
+	db = binary.LittleEndian.AppendUint16(db, uint16(len(segments)))
+	db = binary.LittleEndian.AppendUint32(db, b.offsets(segments))
+	return b.cell(db)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ruleField is a value of a rule in a rules file: a scalar, or a list of scalars.
+type ruleField struct {
+	value  string
+	list   []string
+	isList bool
+	line   int
+}
+
+// ruleFields are the fields of a rule, keyed by name, with the line of the rule.
+type ruleFields struct {
+	fields map[string]ruleField
+	line   int
+}
+
+// loadRules reads and compiles the rules of a rules file.
+//
+// Returns an error if the file cannot be read, a rule is invalid, or two rules
+// have the same id.
+func loadRules(path string) ([]*lintRule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close() //nolint:errcheck
+
+	items, err := parseRules(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	rules := make([]*lintRule, 0, len(items))
+	lines := make(map[string]int, len(items)) // the line of each rule id
+	for i, item := range items {
+		rule, err := newLintRule(item, i)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		// rule ids identify the rules in SARIF, they must be unique
+		if line, ok := lines[rule.id]; ok {
+			return nil, fmt.Errorf("%s: line %d: duplicate rule id %q, first used on line %d", path, item.line, rule.id, line)
+		}
+		lines[rule.id] = item.line
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// parseRules reads the rules of a rules file in YAML: a top-level "rules" key
+// holding a sequence of mappings, whose values are scalars or sequences of scalars.
+//
+//	rules:
+//	  - id: no-dot
+//	    kind: forbidden
+//	    variable: Path
+//	    entry: '.'
+//
+// Returns the fields of each rule, or an error naming the line of an invalid value.
+func parseRules(r io.Reader) ([]ruleFields, error) {
+	var doc yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("missing rules")
+		}
+		return nil, err
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a mapping with rules", root.Line)
+	}
+
+	var rules *yaml.Node
+	for i := 0; i < len(root.Content); i += 2 {
+		key := root.Content[i]
+		if key.Value != "rules" {
+			return nil, fmt.Errorf("line %d: unknown key %q", key.Line, key.Value)
+		}
+		rules = root.Content[i+1]
+	}
+	if rules == nil {
+		return nil, fmt.Errorf("missing rules")
+	}
+	if isNull(rules) {
+		return nil, nil
+	}
+	if rules.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("line %d: rules must be a list", rules.Line)
+	}
+
+	items := make([]ruleFields, 0, len(rules.Content))
+	for _, node := range rules.Content {
+		if node.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("line %d: a rule must be a mapping", node.Line)
+		}
+		item := ruleFields{fields: make(map[string]ruleField), line: node.Line}
+		for i := 0; i < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if _, ok := item.fields[key.Value]; ok {
+				return nil, fmt.Errorf("line %d: duplicate key %q", key.Line, key.Value)
+			}
+			f, err := newRuleField(value)
+			if err != nil {
+				return nil, err
+			}
+			item.fields[key.Value] = f
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// newRuleField returns the field of a YAML value: a scalar, or a sequence of
+// scalars. An empty value is an empty sequence.
+func newRuleField(node *yaml.Node) (ruleField, error) {
+	f := ruleField{line: node.Line}
+	switch {
+	case isNull(node):
+		f.isList = true
+	case node.Kind == yaml.ScalarNode:
+		f.value = node.Value
+	case node.Kind == yaml.SequenceNode:
+		f.isList = true
+		f.list = make([]string, 0, len(node.Content))
+		for _, entry := range node.Content {
+			if entry.Kind != yaml.ScalarNode {
+				return f, fmt.Errorf("line %d: expected a single value", entry.Line)
+			}
+			f.list = append(f.list, entry.Value)
+		}
+	default:
+		return f, fmt.Errorf("line %d: expected a value or a list of values", node.Line)
+	}
+	return f, nil
+}
+
+// isNull reports whether a YAML node is an empty value, eg. "within:".
+func isNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRules(t *testing.T) {
+	input := `# policy
+rules:
+  - id: no-dot   # comment
+    kind: forbidden
+    variable: Path
+    entry: '.'
+  -
+    kind: hive-restriction
+    variable: "Path"
+    within: ['%USERPROFILE%', "C:\\Tools, x"]
+  - kind: hive-restriction
+    within:
+      - '%USERPROFILE%'
+      - C:\it''s
+    message: 'it''s #1'
+`
+	items, err := parseRules(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRules() error = %v", err)
+	}
+	got := make([]map[string]any, len(items))
+	for i, item := range items {
+		got[i] = map[string]any{}
+		for key, f := range item.fields {
+			if f.isList {
+				got[i][key] = f.list
+			} else {
+				got[i][key] = f.value
+			}
+		}
+	}
+	expected := []map[string]any{
+		{"id": "no-dot", "kind": "forbidden", "variable": "Path", "entry": "."},
+		{"kind": "hive-restriction", "variable": "Path", "within": []string{"%USERPROFILE%", `C:\Tools, x`}},
+		{"kind": "hive-restriction", "within": []string{"%USERPROFILE%", `C:\it''s`}, "message": "it's #1"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("parseRules() =\n%v\nwant:\n%v", got, expected)
+	}
+}
+
+func TestParseRules_Forms(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		count int
+	}{
+		{name: "unindented list", input: "rules:\n- id: x\n  kind: required\n- kind: forbidden\n", count: 2},
+		{name: "empty list", input: "rules: []\n", count: 0},
+		{name: "no rules", input: "rules:\n", count: 0},
+		{name: "flow mapping", input: "rules: [{kind: required, variable: X}]\n", count: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := parseRules(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("parseRules() error = %v", err)
+			}
+			if len(items) != tt.count {
+				t.Errorf("parseRules() = %d rules, want %d", len(items), tt.count)
+			}
+		})
+	}
+}
+
+func TestParseRules_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "empty", input: "", expected: "missing rules"},
+		{name: "unknown key", input: "checks:\n", expected: `line 1: unknown key "checks"`},
+		{name: "not a list", input: "rules:\n  kind: required\n", expected: "line 2: rules must be a list"},
+		{name: "not a mapping", input: "rules:\n  - required\n", expected: "line 2: a rule must be a mapping"},
+		{name: "nested value", input: "rules:\n  - kind: {a: b}\n", expected: "line 2: expected a value or a list of values"},
+		{name: "nested list", input: "rules:\n  - within: [[a]]\n", expected: "line 2: expected a single value"},
+		{name: "syntax", input: "rules:\n  - kind: 'required\n", expected: "yaml: line 2: found unexpected end of stream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRules(strings.NewReader(tt.input))
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("parseRules() error = %v, want %q", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadRules_DuplicateID(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "explicit",
+			input:    "rules:\n  - id: home\n    kind: required\n    variable: JAVA_HOME\n  - id: home\n    kind: required\n    variable: M2_HOME\n",
+			expected: `line 5: duplicate rule id "home", first used on line 2`,
+		},
+		{
+			name:     "generated",
+			input:    "rules:\n  - kind: required\n    variable: JAVA_HOME\n  - id: required-1\n    kind: required\n    variable: M2_HOME\n",
+			expected: `line 4: duplicate rule id "required-1", first used on line 2`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.yaml")
+			if err := os.WriteFile(path, []byte(tt.input), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadRules(path)
+			if err == nil || err.Error() != path+": "+tt.expected {
+				t.Errorf("loadRules() error = %v, want %q", err, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Version and schema of SARIF, the format read by code scanning tools, see
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html. The types
+// below define only the properties used by lint.
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifInfoURI = "https://github.com/tischda/peekenv"
+)
+
+// sarifLog is the root object of a SARIF file.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+// sarifRun is a run of an analysis tool, with its results.
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+// sarifTool describes the tool that produced a run.
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+// sarifDriver is the main component of the tool, with the rules it checks.
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+// sarifRule describes a rule, with its default severity level.
+type sarifRule struct {
+	ID                   string       `json:"id"`
+	Name                 string       `json:"name"`
+	ShortDescription     sarifMessage `json:"shortDescription"`
+	DefaultConfiguration sarifConfig  `json:"defaultConfiguration"`
+}
+
+// sarifConfig is the default configuration of a rule.
+type sarifConfig struct {
+	Level string `json:"level"`
+}
+
+// sarifMessage is a plain text message.
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+// sarifResult is a violation of a rule, located by variable.
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+// sarifLocation is the location of a result.
+type sarifLocation struct {
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+// sarifLogicalLocation names a variable, or an entry of a list variable.
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// writeSARIF writes the rules and their violations as a SARIF log. The findings
+// are located by variable (eg. Path[3]) rather than by file, with the hive in
+// the fully qualified name (eg. HKCU\Path[3]).
+func writeSARIF(w io.Writer, rules []*lintRule, findings []lintFinding) error {
+	driver := sarifDriver{Name: name, Version: version, InformationURI: sarifInfoURI, Rules: []sarifRule{}}
+	if driver.Name == "" {
+		driver.Name = "peekenv"
+	}
+	index := make(map[*lintRule]int, len(rules))
+	for i, r := range rules {
+		index[r] = i
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:                   r.id,
+			Name:                 r.kind,
+			ShortDescription:     sarifMessage{Text: r.description()},
+			DefaultConfiguration: sarifConfig{Level: r.severity},
+		})
+	}
+
+	results := make([]sarifResult, 0, len(findings))
+	for _, f := range findings {
+		location := f.variable
+		if f.index >= 0 {
+			location = fmt.Sprintf("%s[%d]", f.variable, f.index)
+		}
+		qualified := location
+		if f.hive != "" {
+			qualified = f.hive + `\` + location
+		}
+		results = append(results, sarifResult{
+			RuleID:    f.rule.id,
+			RuleIndex: index[f.rule],
+			Level:     f.rule.severity,
+			Message:   sarifMessage{Text: f.finding.String()},
+			Locations: []sarifLocation{{LogicalLocations: []sarifLogicalLocation{{
+				Name:               location,
+				FullyQualifiedName: qualified,
+				Kind:               "variable",
+			}}}},
+		})
+	}
+
+	log := sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	}
+	data, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
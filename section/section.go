@@ -0,0 +1,225 @@
+// Package section reads environment variables in the section format written
+// by peekenv and read by pokenv. Each variable starts with a section header
+// containing its name, followed by one entry per line:
+//
+//	# comment
+//
+//	[M2_HOME]
+//	c:\usr\bin\maven
+//
+//	[Path]
+//	c:\Windows\system32
+//	c:\Windows
+//
+// The section header may be followed by the registry value type of the
+// variable, eg. "[Path] REG_EXPAND_SZ".
+//
+// Entries are joined with semicolons to form the value of the variable, readers
+// joining them with another separator use Variable.Entries.
+// Sections are separated by a blank line. Like pokenv, blank lines and lines
+// starting with '#' (comments) are ignored. Both LF and CRLF line endings are
+// accepted.
+//
+// Version 2 of the format is marked by a "# peekenv-format: 2" comment before
+// the first section. In this version, entries that cannot be written as is
+// (see Quote), like empty entries, are written as a backtick followed by a Go
+// quoted string:
+//
+//	[PROMPT]
+//	`"[$P]$G"
+package section
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Version is the latest version of the format, written in the version marker.
+const Version = 2
+
+// VersionMarker is the comment preceding the version number of the format.
+const VersionMarker = "# peekenv-format: "
+
+// quotePrefix starts the lines holding a quoted entry, in version 2.
+const quotePrefix = "`"
+
+// Variable is an environment variable read from a section.
+type Variable struct {
+	Name    string
+	Value   string   // the entries joined with semicolons
+	Entries []string // the entries of the section, one per line
+	Type    string   // registry value type from the section header, empty if not specified
+}
+
+// ParseError describes a syntax error in the input, with 1-based line and column.
+type ParseError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+// Error returns the error message prefixed with the position of the error.
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// Reader reads variables one section at a time.
+type Reader struct {
+	scanner    *bufio.Scanner
+	text       string // current line, without line terminator
+	line       int    // number of lines read so far
+	next       string // name of the next section, if its header has been read
+	nextType   string // value type of the next section
+	nextLine   int    // line of the next section header
+	headerLine int    // line of the header of the last variable returned
+	version    int    // version of the format, from the version marker
+	started    bool
+}
+
+// NewReader returns a Reader reading sections from r.
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return &Reader{scanner: scanner}
+}
+
+// Read returns the next variable, or io.EOF when there are no more sections.
+func (r *Reader) Read() (Variable, error) {
+	if !r.started {
+		r.started = true
+		if err := r.readPreamble(); err != nil {
+			return Variable{}, err
+		}
+	}
+	if r.nextLine == 0 {
+		return Variable{}, io.EOF
+	}
+
+	v := Variable{Name: r.next, Type: r.nextType}
+	r.headerLine = r.nextLine
+	r.nextLine = 0
+
+	var entries []string
+	for r.scan() {
+		text := r.text
+		if strings.HasPrefix(text, "[") {
+			if err := r.parseHeader(text); err != nil {
+				return Variable{}, err
+			}
+			break
+		}
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if r.version >= 2 && strings.HasPrefix(text, quotePrefix) {
+			entry, err := strconv.Unquote(text[len(quotePrefix):])
+			if err != nil {
+				return Variable{}, &ParseError{Line: r.line, Column: 2, Msg: "invalid quoted entry"}
+			}
+			text = entry
+		}
+		entries = append(entries, text)
+	}
+	if err := r.scanner.Err(); err != nil {
+		return Variable{}, err
+	}
+	v.Value = strings.Join(entries, ";")
+	v.Entries = entries
+	return v, nil
+}
+
+// readPreamble skips comments and blank lines up to the first section header.
+func (r *Reader) readPreamble() error {
+	for r.scan() {
+		text := r.text
+		if r.line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		switch {
+		case strings.HasPrefix(text, VersionMarker):
+			version, err := strconv.Atoi(strings.TrimSpace(text[len(VersionMarker):]))
+			if err != nil || version < 1 || version > Version {
+				return &ParseError{Line: r.line, Column: len(VersionMarker) + 1, Msg: "unsupported format version"}
+			}
+			r.version = version
+		case text == "" || strings.HasPrefix(text, "#"):
+			continue
+		case strings.HasPrefix(text, "["):
+			return r.parseHeader(text)
+		default:
+			return &ParseError{Line: r.line, Column: 1, Msg: "expected section header"}
+		}
+	}
+	return r.scanner.Err()
+}
+
+// scan advances to the next line, removing a trailing carriage return.
+func (r *Reader) scan() bool {
+	if !r.scanner.Scan() {
+		return false
+	}
+	r.line++
+	r.text = strings.TrimSuffix(r.scanner.Text(), "\r")
+	return true
+}
+
+// parseHeader reads the variable name and optional value type of the next
+// section from a section header line.
+func (r *Reader) parseHeader(text string) error {
+	name, valtype := text, ""
+	if !strings.HasSuffix(text, "]") {
+		i := strings.LastIndex(text, "] ")
+		if i < 0 {
+			return &ParseError{Line: r.line, Column: len(text) + 1, Msg: "missing closing bracket in section header"}
+		}
+		name, valtype = text[:i+1], text[i+2:]
+		if !strings.HasPrefix(valtype, "REG_") || strings.ContainsAny(valtype, " \t") {
+			return &ParseError{Line: r.line, Column: i + 3, Msg: fmt.Sprintf("invalid value type %q", valtype)}
+		}
+	}
+	name = name[1 : len(name)-1]
+	if name == "" {
+		return &ParseError{Line: r.line, Column: 2, Msg: "empty variable name"}
+	}
+	r.next, r.nextType, r.nextLine = name, valtype, r.line
+	return nil
+}
+
+// Parse reads all variables from r. Variable names must be unique (case-insensitive).
+func Parse(r io.Reader) ([]Variable, error) {
+	reader := NewReader(r)
+	seen := make(map[string]bool)
+
+	var vars []Variable
+	for {
+		v, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return vars, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		key := strings.ToLower(v.Name)
+		if seen[key] {
+			return nil, &ParseError{Line: reader.headerLine, Column: 2, Msg: fmt.Sprintf("duplicate variable %q", v.Name)}
+		}
+		seen[key] = true
+		vars = append(vars, v)
+	}
+}
+
+// Quote returns the line representing an entry in version 2 of the format: the
+// entry itself, or the entry quoted with strconv.Quote and prefixed with a
+// backtick if it is empty, contains a line break or would be read as a section
+// header, a comment or a quoted entry.
+func Quote(entry string) string {
+	if entry == "" || strings.ContainsAny(entry, "\r\n") || strings.HasPrefix(entry, "[") ||
+		strings.HasPrefix(entry, "#") || strings.HasPrefix(entry, quotePrefix) {
+		return quotePrefix + strconv.Quote(entry)
+	}
+	return entry
+}
@@ -0,0 +1,222 @@
+package section
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []Variable
+	}{
+		{
+			name:     "single variable",
+			input:    "[TEMP]\nC:\\Temp\n",
+			expected: []Variable{{Name: "TEMP", Value: `C:\Temp`, Entries: []string{`C:\Temp`}}},
+		},
+		{
+			name:  "path entries are joined with semicolons",
+			input: "[Path]\nC:\\Windows\\System32\nC:\\Windows\n\n[TEMP]\nC:\\Temp\n",
+			expected: []Variable{
+				{Name: "Path", Value: `C:\Windows\System32;C:\Windows`, Entries: []string{`C:\Windows\System32`, `C:\Windows`}},
+				{Name: "TEMP", Value: `C:\Temp`, Entries: []string{`C:\Temp`}},
+			},
+		},
+		{
+			name:  "header comments and blank lines are skipped",
+			input: "# HKEY_CURRENT_USER\\Environment\n# Exported on 2025-09-07\n\n[USER]\njohndoe\n",
+			expected: []Variable{
+				{Name: "USER", Value: "johndoe", Entries: []string{"johndoe"}},
+			},
+		},
+		{
+			name:  "comments inside sections are skipped",
+			input: "[Path]\nC:\\a\n# disabled\nC:\\b\n",
+			expected: []Variable{
+				{Name: "Path", Value: `C:\a;C:\b`, Entries: []string{`C:\a`, `C:\b`}},
+			},
+		},
+		{
+			name:  "empty values",
+			input: "[A]\n\n\n[B]\n\n",
+			expected: []Variable{
+				{Name: "A", Value: ""},
+				{Name: "B", Value: ""},
+			},
+		},
+		{
+			name:  "blank lines inside sections are skipped",
+			input: "[Path]\nC:\\a\n\nC:\\b\n\n\n[TEMP]\nC:\\Temp\n\n",
+			expected: []Variable{
+				{Name: "Path", Value: `C:\a;C:\b`, Entries: []string{`C:\a`, `C:\b`}},
+				{Name: "TEMP", Value: `C:\Temp`, Entries: []string{`C:\Temp`}},
+			},
+		},
+		{
+			name:  "sections without separator",
+			input: "[A]\na\n[B]\nb",
+			expected: []Variable{
+				{Name: "A", Value: "a", Entries: []string{"a"}},
+				{Name: "B", Value: "b", Entries: []string{"b"}},
+			},
+		},
+		{
+			name:  "CRLF line endings and byte order mark",
+			input: "\ufeff[A]\r\na\r\nb\r\n\r\n[B]\r\nc\r\n",
+			expected: []Variable{
+				{Name: "A", Value: "a;b", Entries: []string{"a", "b"}},
+				{Name: "B", Value: "c", Entries: []string{"c"}},
+			},
+		},
+		{
+			name:  "value types in section headers",
+			input: "[Path] REG_EXPAND_SZ\n%SystemRoot%\n\n[a]b] REG_SZ\nx\n\n[COUNT] REG_DWORD\n1\n",
+			expected: []Variable{
+				{Name: "Path", Value: "%SystemRoot%", Entries: []string{"%SystemRoot%"}, Type: "REG_EXPAND_SZ"},
+				{Name: "a]b", Value: "x", Entries: []string{"x"}, Type: "REG_SZ"},
+				{Name: "COUNT", Value: "1", Entries: []string{"1"}, Type: "REG_DWORD"},
+			},
+		},
+		{
+			name:     "no sections",
+			input:    "# nothing here\n\n",
+			expected: nil,
+		},
+		{
+			name:  "quoted entries in version 2",
+			input: "# peekenv-format: 2\n\n[A]\n`\"[x]\\n# y\"\n`\"`\"\n`\"\"\n\n[JDBC]\njdbc:db;user=sa\n",
+			expected: []Variable{
+				{Name: "A", Value: "[x]\n# y;`;", Entries: []string{"[x]\n# y", "`", ""}},
+				{Name: "JDBC", Value: "jdbc:db;user=sa", Entries: []string{"jdbc:db;user=sa"}},
+			},
+		},
+		{
+			name:  "quoted entries are literal without version marker",
+			input: "[A]\n`\"x\"\n",
+			expected: []Variable{
+				{Name: "A", Value: "`\"x\"", Entries: []string{"`\"x\""}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Parse() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		line   int
+		column int
+	}{
+		{
+			name:   "content before first section",
+			input:  "# header\nC:\\Temp\n[TEMP]\n",
+			line:   2,
+			column: 1,
+		},
+		{
+			name:   "missing closing bracket",
+			input:  "[TEMP]\nC:\\Temp\n\n[Path\n",
+			line:   4,
+			column: 6,
+		},
+		{
+			name:   "invalid value type",
+			input:  "[Path] EXPAND\n",
+			line:   1,
+			column: 8,
+		},
+		{
+			name:   "empty variable name",
+			input:  "[]\nvalue\n",
+			line:   1,
+			column: 2,
+		},
+		{
+			name:   "duplicate variable",
+			input:  "[Path]\na\n\n[PATH]\nb\n",
+			line:   4,
+			column: 2,
+		},
+		{
+			name:   "unsupported version",
+			input:  "# peekenv-format: 3\n[A]\n",
+			line:   1,
+			column: 19,
+		},
+		{
+			name:   "invalid quoted entry",
+			input:  "# peekenv-format: 2\n[A]\n`\"unterminated\n",
+			line:   3,
+			column: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.input))
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("Parse() error = %v, want *ParseError", err)
+			}
+			if perr.Line != tt.line || perr.Column != tt.column {
+				t.Errorf("Parse() error at %d:%d, want %d:%d (%v)", perr.Line, perr.Column, tt.line, tt.column, perr)
+			}
+		})
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		entry    string
+		expected string
+	}{
+		{`C:\Windows`, `C:\Windows`},
+		{"", "`\"\""},
+		{"a;b", "a;b"},
+		{"a # b [c]", "a # b [c]"},
+		{"[section]", "`\"[section]\""},
+		{"# comment", "`\"# comment\""},
+		{"`tick", "`\"`tick\""},
+		{"two\nlines", "`\"two\\nlines\""},
+		{"cr\r", "`\"cr\\r\""},
+	}
+	for _, tt := range tests {
+		if got := Quote(tt.entry); got != tt.expected {
+			t.Errorf("Quote(%q) = %q, want %q", tt.entry, got, tt.expected)
+		}
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	f.Add("[TEMP]\nC:\\Temp\n")
+	f.Add("# header\n\n[Path]\na\nb\n\n[B]\n")
+	f.Add("[\n")
+	f.Fuzz(func(t *testing.T, input string) {
+		vars, err := Parse(strings.NewReader(input))
+		var perr *ParseError
+		if err != nil && errors.As(err, &perr) && (perr.Line < 1 || perr.Column < 1) {
+			t.Errorf("Parse() error with invalid position: %v", perr)
+		}
+		for _, v := range vars {
+			if v.Name == "" {
+				t.Errorf("Parse() returned variable without name: %q", vars)
+			}
+		}
+	})
+}
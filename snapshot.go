@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tischda/peekenv/v3/envreg"
+)
+
+// indexFile is the name of the file listing the snapshots of a store.
+const indexFile = "index.json"
+
+// historyTime is the layout of the snapshot times printed by history.
+const historyTime = "2006-01-02 15:04:05 -0700"
+
+// snapshotInfo describes a snapshot in the index of the store.
+type snapshotInfo struct {
+	ID     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	Host   string    `json:"host"`
+	User   string    `json:"user"`
+	Source string    `json:"source"` // registry, or the files the variables were read from
+	Count  int       `json:"count"`  // number of variables
+}
+
+// snapshot is a capture of the environment variables at a point in time.
+type snapshot struct {
+	snapshotInfo
+	Variables map[string]snapshotVariable `json:"variables"`
+}
+
+// snapshotVariable is a variable of a snapshot, with its registry value type
+// and the hive it was read from.
+type snapshotVariable struct {
+	Value string `json:"value"`
+	Type  string `json:"type"`
+	Hive  string `json:"hive"`
+}
+
+// snapshotStore is a directory holding one JSON file per snapshot, and an index
+// listing the snapshots in the order they were taken.
+type snapshotStore struct {
+	dir string
+}
+
+// defaultStoreDir returns the directory of the snapshot store in the user
+// configuration directory, eg. %AppData%\peekenv\snapshots.
+func defaultStoreDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "snapshots"
+	}
+	return filepath.Join(dir, "peekenv", "snapshots")
+}
+
+// newSnapshot returns a snapshot of the variables of env, taken now by the current
+// user. The host or user name are left empty if they cannot be determined.
+//
+// Parameters:
+//   - env: the variables to capture
+//   - source: where the variables were read from
+//   - now: the time of the capture
+func newSnapshot(env *envreg.Environment, source string, now time.Time) *snapshot {
+	snap := &snapshot{
+		snapshotInfo: snapshotInfo{Time: now, Source: source, Count: len(env.Variables)},
+		Variables:    make(map[string]snapshotVariable, len(env.Variables)),
+	}
+	snap.Host, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		snap.User = u.Username
+	}
+	for name, v := range env.Variables {
+		snap.Variables[name] = snapshotVariable{
+			Value: v.Value,
+			Type:  envreg.TypeName(v.Type),
+			Hive:  v.Hive.String(),
+		}
+	}
+	return snap
+}
+
+// save writes the snapshot to a new file named after its time, eg.
+// 20251017T083000Z.json, and appends it to the index. The ID of the snapshot
+// is set to the name of the file, without extension.
+//
+// Returns an error if the snapshot or the index cannot be written.
+func (s snapshotStore) save(snap *snapshot) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("creating snapshot store: %w", err)
+	}
+	index, err := s.index()
+	if err != nil {
+		return err
+	}
+
+	// snapshots taken within the same second get a numbered suffix
+	base := snap.Time.UTC().Format("20060102T150405Z")
+	var file *os.File
+	for n := 1; ; n++ {
+		snap.ID = base
+		if n > 1 {
+			snap.ID = fmt.Sprintf("%s-%d", base, n)
+		}
+		file, err = os.OpenFile(filepath.Join(s.dir, snap.ID+".json"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if !errors.Is(err, fs.ErrExist) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("creating snapshot: %w", err)
+	}
+	defer file.Close() //nolint:errcheck
+
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	return s.writeIndex(append(index, snap.snapshotInfo))
+}
+
+// index returns the snapshots of the store, in the order they were taken.
+// A store that does not exist yet has no snapshots.
+func (s snapshotStore) index() ([]snapshotInfo, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, indexFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot index: %w", err)
+	}
+	var index []snapshotInfo
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("reading snapshot index: %w", err)
+	}
+	return index, nil
+}
+
+// writeIndex replaces the index of the store, through a temporary file so that
+// an interrupted write does not lose the previous index.
+func (s snapshotStore) writeIndex(index []snapshotInfo) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, indexFile)
+	if err := os.WriteFile(path+".tmp", append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing snapshot index: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("writing snapshot index: %w", err)
+	}
+	return nil
+}
+
+// load reads the snapshot with the specified ID.
+func (s snapshotStore) load(id string) (*snapshot, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, id+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot: %w", err)
+	}
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("reading snapshot %s: %w", id, err)
+	}
+	return &snap, nil
+}
+
+// lookup returns the variable with the specified name (case-insensitive) and
+// its name in the snapshot.
+func (snap *snapshot) lookup(name string) (string, snapshotVariable, bool) {
+	if v, ok := snap.Variables[name]; ok {
+		return name, v, true
+	}
+	for k, v := range snap.Variables {
+		if strings.EqualFold(k, name) {
+			return k, v, true
+		}
+	}
+	return "", snapshotVariable{}, false
+}
+
+// sourceName describes where the variables are read from: the registry, or the
+// .reg or hive files specified on the command line.
+func (cfg *Config) sourceName() string {
+	switch {
+	case len(cfg.regFiles) > 0:
+		return "reg: " + strings.Join(cfg.regFiles, ", ")
+	case cfg.hiveSystem != "" || cfg.hiveUser != "":
+		return "hive: " + strings.Join(strings.Fields(cfg.hiveSystem+" "+cfg.hiveUser), ", ")
+	}
+	return "registry"
+}
+
+// runSnapshot reads the environment and saves it as a new snapshot in the store.
+//
+// Parameters:
+//   - cfg: the runtime configuration specifying the registry mode and the store
+//   - p: the peekenv instance reading the environment
+//   - w: the writer receiving the ID of the snapshot
+//
+// Returns an error if the environment cannot be read or the snapshot cannot be saved.
+func runSnapshot(cfg *Config, p *peekenv, w io.Writer) error {
+	if err := p.read(cfg.mode(), cfg.expand); err != nil {
+		return err
+	}
+	snap := newSnapshot(p.env, cfg.sourceName(), time.Now())
+	if err := (snapshotStore{dir: cfg.store}).save(snap); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s: saved %d variables to %s\n", snap.ID, snap.Count, cfg.store)
+	return nil
+}
+
+// runHistory lists the snapshots of the store, or shows how a variable changed
+// across the snapshots: each snapshot where the value, type or hive of the
+// variable changed is printed with its time, followed by the differences with
+// the previous value (see writeDiff).
+//
+// Parameters:
+//   - cfg: the runtime configuration specifying the store
+//   - p: the peekenv instance, whose merge policy tells which variables are lists
+//   - args: the name of the variable, or nothing to list the snapshots
+//   - w: the writer receiving the history
+//
+// Returns an error if the store cannot be read, or the variable is in no snapshot.
+func runHistory(cfg *Config, p *peekenv, args []string, w io.Writer) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: %s history [NAME]", name)
+	}
+	store := snapshotStore{dir: cfg.store}
+	index, err := store.index()
+	if err != nil {
+		return err
+	}
+	if len(index) == 0 {
+		return fmt.Errorf("no snapshots in %s", cfg.store)
+	}
+	if len(args) == 0 {
+		for _, info := range index {
+			fmt.Fprintf(w, "%s  %s  %s  %s  %d variables (%s)\n",
+				info.ID, info.Time.Format(historyTime), info.Host, info.User, info.Count, info.Source)
+		}
+		return nil
+	}
+
+	// previous is the variable in the last snapshot, nil if it was not defined
+	var previous *snapshotVariable
+	var previousName string
+	found := false
+	for _, info := range index {
+		snap, err := store.load(info.ID)
+		if err != nil {
+			return err
+		}
+		key, v, ok := snap.lookup(args[0])
+		if !ok && previous == nil || ok && previous != nil && v == *previous {
+			continue
+		}
+
+		before, after := map[string]string{}, map[string]string{}
+		if previous != nil {
+			before[previousName] = previous.Value
+		}
+		if ok {
+			found = true
+			after[key] = v.Value
+			fmt.Fprintf(w, "# %s  %s  %s %s\n", info.Time.Format(historyTime), info.ID, v.Hive, v.Type)
+			previous, previousName = &v, key
+		} else {
+			fmt.Fprintf(w, "# %s  %s\n", info.Time.Format(historyTime), info.ID)
+			previous = nil
+		}
+		writeDiff(w, diffEnv(before, after, p.opts.Merge))
+	}
+	if !found {
+		return fmt.Errorf("variable not found in snapshots: %s", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tischda/peekenv/v3/envreg"
+)
+
+// saveSnapshot saves a snapshot of variables taken at the specified time.
+func saveSnapshot(t *testing.T, store snapshotStore, at time.Time, vars map[string]snapshotVariable) string {
+	t.Helper()
+	snap := &snapshot{
+		snapshotInfo: snapshotInfo{Time: at, Host: "PC01", User: `PC01\john`, Source: "registry", Count: len(vars)},
+		Variables:    vars,
+	}
+	if err := store.save(snap); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+	return snap.ID
+}
+
+func TestSnapshotStore_Save(t *testing.T) {
+	store := snapshotStore{dir: t.TempDir()}
+	at := time.Date(2025, 10, 17, 8, 30, 0, 0, time.UTC)
+	vars := map[string]snapshotVariable{"OS": {Value: "Windows_NT", Type: "REG_SZ", Hive: "HKLM"}}
+
+	ids := []string{
+		saveSnapshot(t, store, at, vars),
+		saveSnapshot(t, store, at, vars),
+	}
+	expected := []string{"20251017T083000Z", "20251017T083000Z-2"}
+	if strings.Join(ids, ",") != strings.Join(expected, ",") {
+		t.Errorf("save() IDs = %v, want %v", ids, expected)
+	}
+
+	index, err := store.index()
+	if err != nil {
+		t.Fatalf("index() error = %v", err)
+	}
+	if len(index) != 2 || index[1].ID != expected[1] || index[1].User != `PC01\john` || index[1].Count != 1 {
+		t.Errorf("index() = %+v, want both snapshots", index)
+	}
+	snap, err := store.load(ids[0])
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	if !snap.Time.Equal(at) || snap.Variables["OS"] != vars["OS"] {
+		t.Errorf("load() = %+v, want saved snapshot", snap)
+	}
+}
+
+func TestRunHistory(t *testing.T) {
+	dir := t.TempDir()
+	store := snapshotStore{dir: dir}
+	day := func(d int) time.Time {
+		return time.Date(2025, 10, d, 9, 0, 0, 0, time.FixedZone("", 2*3600))
+	}
+	saveSnapshot(t, store, day(1), map[string]snapshotVariable{
+		"Path": {Value: `C:\Windows;C:\Tools`, Type: "REG_EXPAND_SZ", Hive: "HKLM+HKCU"},
+		"TEMP": {Value: `C:\Temp`, Type: "REG_SZ", Hive: "HKCU"},
+	})
+	saveSnapshot(t, store, day(2), map[string]snapshotVariable{
+		"Path": {Value: `C:\Windows;C:\Tools`, Type: "REG_EXPAND_SZ", Hive: "HKLM+HKCU"},
+	})
+	saveSnapshot(t, store, day(3), map[string]snapshotVariable{
+		"PATH": {Value: `C:\Windows;C:\Git\cmd;C:\Tools`, Type: "REG_EXPAND_SZ", Hive: "HKLM+HKCU"},
+		"TEMP": {Value: `D:\Temp`, Type: "REG_EXPAND_SZ", Hive: "HKCU"},
+	})
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name: "list",
+			expected: `20251001T070000Z  2025-10-01 09:00:00 +0200  PC01  PC01\john  2 variables (registry)
+20251002T070000Z  2025-10-02 09:00:00 +0200  PC01  PC01\john  1 variables (registry)
+20251003T070000Z  2025-10-03 09:00:00 +0200  PC01  PC01\john  2 variables (registry)
+`,
+		},
+		{
+			name: "list variable",
+			args: []string{"path"},
+			expected: `# 2025-10-01 09:00:00 +0200  20251001T070000Z  HKLM+HKCU REG_EXPAND_SZ
++ Path=C:\Windows;C:\Tools
+# 2025-10-03 09:00:00 +0200  20251003T070000Z  HKLM+HKCU REG_EXPAND_SZ
+~ PATH
+    + [1] C:\Git\cmd
+`,
+		},
+		{
+			name: "removed and added again",
+			args: []string{"TEMP"},
+			expected: `# 2025-10-01 09:00:00 +0200  20251001T070000Z  HKCU REG_SZ
++ TEMP=C:\Temp
+# 2025-10-02 09:00:00 +0200  20251002T070000Z
+- TEMP=C:\Temp
+# 2025-10-03 09:00:00 +0200  20251003T070000Z  HKCU REG_EXPAND_SZ
++ TEMP=D:\Temp
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := runHistory(&Config{store: dir}, &peekenv{}, tt.args, &buf); err != nil {
+				t.Fatalf("runHistory() error = %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("runHistory() =\n%s\nwant:\n%s", buf.String(), tt.expected)
+			}
+		})
+	}
+
+	if err := runHistory(&Config{store: dir}, &peekenv{}, []string{"JAVA_HOME"}, &bytes.Buffer{}); err == nil {
+		t.Error("runHistory() expected error for a variable in no snapshot")
+	}
+	if err := runHistory(&Config{store: t.TempDir()}, &peekenv{}, nil, &bytes.Buffer{}); err == nil {
+		t.Error("runHistory() expected error for an empty store")
+	}
+}
+
+func TestRunSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	system, user := fixtureSources()
+	p := &peekenv{opts: envreg.Options{Variables: []string{"Path", "OS"}, System: system, User: user}}
+	var buf bytes.Buffer
+	if err := runSnapshot(&Config{store: dir}, p, &buf); err != nil {
+		t.Fatalf("runSnapshot() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), ": saved 2 variables to ") {
+		t.Errorf("runSnapshot() printed %q, want saved 2 variables", buf.String())
+	}
+
+	store := snapshotStore{dir: dir}
+	index, err := store.index()
+	if err != nil || len(index) != 1 {
+		t.Fatalf("index() = %v, %v, want one snapshot", index, err)
+	}
+	snap, err := store.load(index[0].ID)
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	expected := snapshotVariable{
+		Value: `%SystemRoot%\system32;%SystemRoot%;%USERPROFILE%\AppData\Local\Microsoft\WindowsApps`,
+		Type:  "REG_EXPAND_SZ",
+		Hive:  "HKLM+HKCU",
+	}
+	if snap.Variables["Path"] != expected || snap.Source != "registry" {
+		t.Errorf("snapshot = %+v, want Path %+v read from registry", snap, expected)
+	}
+}
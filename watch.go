@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tischda/peekenv/v3/envreg"
+)
+
+// changeKinds are the names of the kinds of change in the JSON lines of watch.
+var changeKinds = map[rune]string{
+	added:   "added",
+	removed: "removed",
+	changed: "changed",
+}
+
+// watchEvent is the JSON representation of a variable change reported by watch.
+type watchEvent struct {
+	Time     time.Time    `json:"time"`
+	Kind     string       `json:"kind"`
+	Name     string       `json:"name"`
+	OldValue *string      `json:"oldValue,omitempty"`
+	NewValue *string      `json:"newValue,omitempty"`
+	Entries  []watchEntry `json:"entries,omitempty"`
+}
+
+// watchEntry is the JSON representation of a changed Path entry. The index is -1
+// in the list that does not contain the entry.
+type watchEntry struct {
+	Kind     string `json:"kind"`
+	Entry    string `json:"entry"`
+	OldIndex int    `json:"oldIndex"`
+	NewIndex int    `json:"newIndex"`
+}
+
+// envWatcher detects the changes of the environment between two reads.
+type envWatcher struct {
+	p      *peekenv
+	mode   envreg.Mode
+	expand bool
+	last   map[string]string // the variables of the previous read
+}
+
+// changes reads the environment again and returns the differences with the
+// previous read. The first read has no differences. Variables that are not
+// defined are not an error, they may be added later.
+func (ew *envWatcher) changes() ([]varChange, error) {
+	opts := ew.p.opts
+	opts.Mode = ew.mode
+	opts.Expand = ew.expand
+	opts.AllowEmpty = true
+	env, err := envreg.Read(context.Background(), opts)
+	if err != nil {
+		return nil, err
+	}
+	ew.p.env = env
+	ew.p.unmatched = env.Unmatched
+	ew.p.unreadable = env.Unreadable
+
+	current := make(map[string]string, len(env.Variables))
+	for name, v := range env.Variables {
+		current[name] = v.Value
+	}
+	previous := ew.last
+	ew.last = current
+	if previous == nil {
+		return nil, nil
+	}
+	return diffEnv(previous, current, ew.p.opts.Merge), nil
+}
+
+// runWatch watches the Environment keys and writes the differences each time
+// variables are added, removed or changed, until ctx is done. The registry
+// notifies the changes on Windows, other sources are polled every cfg.interval.
+//
+// Parameters:
+//   - ctx: watching stops when ctx is done, eg. on Ctrl+C
+//   - cfg: the runtime configuration specifying the registry mode and the format
+//   - p: the peekenv instance reading the environment
+//   - w: the writer receiving the differences
+//
+// Returns an error if the format is not supported, or the environment cannot be
+// read or watched.
+func runWatch(ctx context.Context, cfg *Config, p *peekenv, w io.Writer) error {
+	if cfg.format != "text" && cfg.format != "json" {
+		return fmt.Errorf("watch supports the text and json formats, not %s", cfg.format)
+	}
+	if cfg.interval <= 0 {
+		return fmt.Errorf("invalid interval: %s", cfg.interval)
+	}
+	ew := &envWatcher{p: p, mode: cfg.mode(), expand: cfg.expand}
+	if _, err := ew.changes(); err != nil {
+		return err
+	}
+
+	var sources []envreg.Source
+	if ew.mode != envreg.User {
+		sources = append(sources, p.opts.System)
+	}
+	if ew.mode != envreg.Machine {
+		sources = append(sources, p.opts.User)
+	}
+	notify, err := envreg.Watch(ctx, cfg.interval, sources...)
+	if err != nil {
+		return fmt.Errorf("watching the registry: %w", err)
+	}
+	for range notify {
+		changes, err := ew.changes()
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		if cfg.format == "json" {
+			err = writeWatchJSON(w, time.Now(), changes)
+		} else {
+			fmt.Fprintf(w, "# %s\n", time.Now().Format(historyTime))
+			writeDiff(w, changes)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeWatchJSON writes the differences as JSON lines, one object per variable.
+//
+// Parameters:
+//   - w: the writer receiving the lines
+//   - now: the time the differences were detected
+//   - changes: the differences to write
+func writeWatchJSON(w io.Writer, now time.Time, changes []varChange) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, c := range changes {
+		event := watchEvent{Time: now, Kind: changeKinds[c.kind], Name: c.name}
+		if c.kind != added {
+			event.OldValue = &c.oldValue
+		}
+		if c.kind != removed {
+			event.NewValue = &c.newValue
+		}
+		for _, e := range c.entries {
+			event.Entries = append(event.Entries, watchEntry{
+				Kind:     changeKinds[e.kind],
+				Entry:    e.entry,
+				OldIndex: e.oldIndex,
+				NewIndex: e.newIndex,
+			})
+		}
+		if err := enc.Encode(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tischda/peekenv/v3/envreg"
+)
+
+func TestEnvWatcher_Changes(t *testing.T) {
+	system, user := fixtureSources()
+	policy, err := envreg.NewMergePolicy("Path", "system", ";")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &peekenv{
+		opts: envreg.Options{System: system, User: user, Merge: policy, Variables: []string{"Path", "JAVA_HOME", "M2_HOME"}},
+	}
+	ew := &envWatcher{p: p, mode: envreg.Both}
+
+	// each step changes the sources, then the changes are read
+	steps := []struct {
+		name     string
+		script   func()
+		expected []varChange
+	}{
+		{
+			name:   "initial",
+			script: func() {},
+		},
+		{
+			name:   "unchanged",
+			script: func() { system.Set("OS", "changed", envreg.REG_SZ) },
+		},
+		{
+			name:   "added",
+			script: func() { system.Set("JAVA_HOME", `C:\jdk`, envreg.REG_SZ) },
+			expected: []varChange{
+				{kind: added, name: "JAVA_HOME", newValue: `C:\jdk`},
+			},
+		},
+		{
+			name: "changed and removed",
+			script: func() {
+				user := envreg.NewMemSource(envreg.HKCU)
+				user.Set("Path", `C:\jdk\bin;%USERPROFILE%\AppData\Local\Microsoft\WindowsApps`, envreg.REG_EXPAND_SZ)
+				p.opts.User = user
+			},
+			expected: []varChange{
+				{kind: removed, name: "M2_HOME", oldValue: `c:\usr\bin\maven`},
+				{
+					kind:     changed,
+					name:     "Path",
+					oldValue: `%SystemRoot%\system32;%SystemRoot%;%USERPROFILE%\AppData\Local\Microsoft\WindowsApps`,
+					newValue: `%SystemRoot%\system32;%SystemRoot%;C:\jdk\bin;%USERPROFILE%\AppData\Local\Microsoft\WindowsApps`,
+					entries:  []entryChange{{kind: added, entry: `C:\jdk\bin`, oldIndex: -1, newIndex: 2}},
+				},
+			},
+		},
+	}
+	for _, step := range steps {
+		step.script()
+		got, err := ew.changes()
+		if err != nil {
+			t.Fatalf("%s: changes() error = %v", step.name, err)
+		}
+		if !reflect.DeepEqual(got, step.expected) {
+			t.Errorf("%s: changes() = %+v, want %+v", step.name, got, step.expected)
+		}
+	}
+}
+
+func TestWriteWatchJSON(t *testing.T) {
+	now := time.Date(2026, 10, 17, 14, 2, 11, 0, time.UTC)
+	changes := []varChange{
+		{kind: added, name: "JAVA_HOME", newValue: `C:\jdk`},
+		{kind: removed, name: "EMPTY", oldValue: ""},
+		{kind: changed, name: "Path", oldValue: "a", newValue: "a;b", entries: []entryChange{{kind: added, entry: "b", oldIndex: -1, newIndex: 1}}},
+	}
+	var buf bytes.Buffer
+	if err := writeWatchJSON(&buf, now, changes); err != nil {
+		t.Fatalf("writeWatchJSON() error = %v", err)
+	}
+	expected := `{"time":"2026-10-17T14:02:11Z","kind":"added","name":"JAVA_HOME","newValue":"C:\\jdk"}
+{"time":"2026-10-17T14:02:11Z","kind":"removed","name":"EMPTY","oldValue":""}
+{"time":"2026-10-17T14:02:11Z","kind":"changed","name":"Path","oldValue":"a","newValue":"a;b","entries":[{"kind":"added","entry":"b","oldIndex":-1,"newIndex":1}]}
+`
+	if buf.String() != expected {
+		t.Errorf("writeWatchJSON() =\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
+
+func TestRunWatch(t *testing.T) {
+	system, user := fixtureSources()
+	p := &peekenv{opts: envreg.Options{System: system, User: user}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var buf bytes.Buffer
+	cfg := &Config{format: "text", interval: 5 * time.Millisecond}
+	if err := runWatch(ctx, cfg, p, &buf); err != nil {
+		t.Fatalf("runWatch() error = %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("runWatch() = %q, want no changes", buf.String())
+	}
+
+	cfg.format = "reg"
+	if err := runWatch(ctx, cfg, p, &buf); err == nil {
+		t.Error("runWatch() expected error for the reg format")
+	}
+}